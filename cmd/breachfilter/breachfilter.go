@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/superstackhq/identity/internal/app/identity/breach"
+)
+
+func main() {
+	input := flag.String("input", "", "HIBP SHA-1 dataset: a HASH:COUNT file or a directory of range files")
+	output := flag.String("output", "breached.bloom", "path of the bloom filter to write")
+	falsePositiveRate := flag.Float64("fp-rate", 0.001, "target false positive rate")
+	flag.Parse()
+
+	if len(*input) == 0 {
+		log.Fatal("input is required")
+	}
+
+	var count uint64
+
+	err := walk(*input, func(hash string) error {
+		count++
+		return nil
+	})
+
+	if err != nil {
+		log.Fatalf("error while reading dataset: %v", err)
+	}
+
+	filter := breach.NewBloomFilter(count, *falsePositiveRate)
+
+	err = walk(*input, filter.AddHash)
+
+	if err != nil {
+		log.Fatalf("error while building bloom filter: %v", err)
+	}
+
+	file, err := os.Create(*output)
+
+	if err != nil {
+		log.Fatalf("error while creating %s: %v", *output, err)
+	}
+
+	writer := bufio.NewWriter(file)
+
+	if _, err = filter.WriteTo(writer); err == nil {
+		err = writer.Flush()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		log.Fatalf("error while writing %s: %v", *output, err)
+	}
+
+	log.Printf("wrote bloom filter with %d hashes to %s", count, *output)
+}
+
+func walk(input string, fn func(hash string) error) error {
+	info, err := os.Stat(input)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return scan(input, "", fn)
+	}
+
+	entries, err := os.ReadDir(input)
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(entry.Name(), ".txt")
+
+		if len(prefix) != 5 {
+			continue
+		}
+
+		err = scan(filepath.Join(input, entry.Name()), prefix, fn)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scan(path string, prefix string, fn func(hash string) error) error {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+
+		err = fn(prefix + hash)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
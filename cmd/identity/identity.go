@@ -1,16 +1,109 @@
 package main
 
 import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/superstackhq/common/env"
 	"github.com/superstackhq/identity/internal/app/identity"
+	"github.com/superstackhq/identity/internal/app/identity/mail"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/ratelimit"
+	"github.com/superstackhq/identity/internal/app/identity/throttle"
 )
 
 func main() {
 	identity.NewServer(&identity.Config{
-		Host:          env.GetOrDefault("HOST", "0.0.0.0"),
-		Port:          env.GetOrDefault("PORT", "8000"),
-		MongoEndpoint: env.GetOrDefault("MONGO_ENDPOINT", "mongodb://localhost:27017"),
-		MongoDatabase: env.GetOrDefault("MONGO_DATABASE", "identity"),
-		JwtSecretKey:  env.GetOrDefault("JWT_SECRET_KEY", "secret"),
+		Host:                       env.GetOrDefault("HOST", "0.0.0.0"),
+		Port:                       env.GetOrDefault("PORT", "8000"),
+		TrustedProxies:             getList("TRUSTED_PROXIES"),
+		MongoEndpoint:              env.GetOrDefault("MONGO_ENDPOINT", "mongodb://localhost:27017"),
+		MongoDatabase:              env.GetOrDefault("MONGO_DATABASE", "identity"),
+		JwtSecretKey:               env.GetOrDefault("JWT_SECRET_KEY", "secret"),
+		BreachedPasswordsRangePath: env.GetOrDefault("BREACHED_PASSWORDS_RANGE_PATH", ""),
+		BreachedPasswordsBloomPath: env.GetOrDefault("BREACHED_PASSWORDS_BLOOM_PATH", ""),
+		PasswordHashAlgorithm:      env.GetOrDefault("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		BcryptCost:                 getIntOrDefault("BCRYPT_COST", 10),
+		Argon2idParams: password.Argon2idParams{
+			Memory:      uint32(getIntOrDefault("ARGON2ID_MEMORY_KIB", 64*1024)),
+			Iterations:  uint32(getIntOrDefault("ARGON2ID_ITERATIONS", 3)),
+			Parallelism: uint8(getIntOrDefault("ARGON2ID_PARALLELISM", 2)),
+		},
+		WebURL: env.GetOrDefault("WEB_URL", "http://localhost:3000"),
+		SMTP: mail.SMTPConfig{
+			Host:     env.GetOrDefault("SMTP_HOST", ""),
+			Port:     env.GetOrDefault("SMTP_PORT", "25"),
+			Username: env.GetOrDefault("SMTP_USERNAME", ""),
+			Password: env.GetOrDefault("SMTP_PASSWORD", ""),
+			From:     env.GetOrDefault("MAIL_FROM", "identity@localhost"),
+		},
+		LoginThrottle: throttle.Config{
+			UserMaxFailures: getIntOrDefault("LOGIN_USER_MAX_FAILURES", 5),
+			IPMaxFailures:   getIntOrDefault("LOGIN_IP_MAX_FAILURES", 50),
+			FailureWindow:   getDurationOrDefault("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			LockoutDuration: getDurationOrDefault("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			BaseDelay:       getDurationOrDefault("LOGIN_BASE_DELAY", 1*time.Second),
+			MaxDelay:        getDurationOrDefault("LOGIN_MAX_DELAY", 30*time.Second),
+		},
+		RateLimit: ratelimit.Config{
+			Enabled: env.GetOrDefault("RATE_LIMIT_ENABLED", "true") == "true",
+			Store:   ratelimit.StoreType(env.GetOrDefault("RATE_LIMIT_STORE", string(ratelimit.StoreMemory))),
+			Rules:   getRateLimitRules("RATE_LIMIT_RULES"),
+		},
+		SessionDuration:    getDurationOrDefault("SESSION_DURATION", 7*24*time.Hour),
+		InvitationValidity: getDurationOrDefault("INVITATION_VALIDITY", 7*24*time.Hour),
+		UserRetention:      getDurationOrDefault("USER_RETENTION", 30*24*time.Hour),
+		UserPurgeInterval:  getDurationOrDefault("USER_PURGE_INTERVAL", 1*time.Hour),
 	}).Start()
 }
+
+func getIntOrDefault(key string, defaultValue int) int {
+	value, err := strconv.Atoi(env.GetOrDefault(key, strconv.Itoa(defaultValue)))
+
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
+
+// getList splits a comma separated value. It is nil when the value is empty.
+func getList(key string) []string {
+	var values []string
+
+	for _, value := range strings.Split(env.GetOrDefault(key, ""), ",") {
+		if value = strings.TrimSpace(value); len(value) != 0 {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(env.GetOrDefault(key, defaultValue.String()))
+
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
+
+func getRateLimitRules(key string) []ratelimit.Rule {
+	spec := env.GetOrDefault(key, "")
+
+	if len(spec) == 0 {
+		return ratelimit.DefaultRules()
+	}
+
+	rules, err := ratelimit.ParseRules(spec)
+
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+
+	return rules
+}
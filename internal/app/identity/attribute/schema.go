@@ -0,0 +1,288 @@
+package attribute
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxDefinitions = 50
+
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Violations))
+
+	for key := range e.Violations {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	messages := make([]string, 0, len(keys))
+
+	for _, key := range keys {
+		messages = append(messages, fmt.Sprintf("%s %s", key, e.Violations[key]))
+	}
+
+	return "invalid metadata: " + strings.Join(messages, ", ")
+}
+
+// Check reports whether the schema itself is well formed.
+func (s Schema) Check() error {
+	if len(s) > maxDefinitions {
+		return fmt.Errorf("an organization can define at most %d attributes", maxDefinitions)
+	}
+
+	keys := make(map[string]bool, len(s))
+
+	for _, d := range s {
+		if !keyPattern.MatchString(d.Key) {
+			return fmt.Errorf("attribute key %s must be lowercase letters, digits and underscores", d.Key)
+		}
+
+		if keys[d.Key] {
+			return fmt.Errorf("attribute %s is defined twice", d.Key)
+		}
+
+		keys[d.Key] = true
+
+		switch d.Type {
+		case TypeString:
+			if len(d.Pattern) != 0 {
+				if _, err := d.compiledPattern(); err != nil {
+					return fmt.Errorf("attribute %s has an invalid pattern", d.Key)
+				}
+			}
+		case TypeEnum:
+			if len(d.Values) == 0 {
+				return fmt.Errorf("enum attribute %s needs values", d.Key)
+			}
+		case TypeNumber, TypeBool, TypeDate:
+		default:
+			return fmt.Errorf("attribute %s has unknown type %s", d.Key, d.Type)
+		}
+
+		if d.Min != nil && d.Max != nil && *d.Min > *d.Max {
+			return fmt.Errorf("attribute %s has a min greater than its max", d.Key)
+		}
+	}
+
+	return nil
+}
+
+// Get returns the definition with the key, or nil if there is none.
+func (s Schema) Get(key string) *Definition {
+	for _, d := range s {
+		if d.Key == key {
+			return d
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the values against the schema and returns them in their
+// stored form. Null values remove the attribute.
+func (s Schema) Validate(values map[string]interface{}) (map[string]interface{}, error) {
+	violations := make(map[string]string)
+	metadata := make(map[string]interface{}, len(values))
+
+	for key, value := range values {
+		d := s.Get(key)
+
+		if d == nil {
+			violations[key] = "is not defined"
+			continue
+		}
+
+		if value == nil {
+			continue
+		}
+
+		normalized, err := d.normalize(value)
+
+		if err != nil {
+			violations[key] = err.Error()
+			continue
+		}
+
+		metadata[key] = normalized
+	}
+
+	for _, d := range s {
+		if _, ok := metadata[d.Key]; d.Required && !ok {
+			violations[d.Key] = "is required"
+		}
+	}
+
+	if len(violations) != 0 {
+		return nil, &ValidationError{Violations: violations}
+	}
+
+	return metadata, nil
+}
+
+// Filter converts query string values into values that can be matched against
+// stored metadata.
+func (s Schema) Filter(values map[string]string) (map[string]interface{}, error) {
+	filter := make(map[string]interface{}, len(values))
+
+	for key, value := range values {
+		d := s.Get(key)
+
+		if d == nil {
+			return nil, fmt.Errorf("cannot filter by unknown attribute %s", key)
+		}
+
+		var raw interface{} = value
+
+		switch d.Type {
+		case TypeNumber:
+			number, err := strconv.ParseFloat(value, 64)
+
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s must be a number", key)
+			}
+
+			raw = number
+		case TypeBool:
+			b, err := strconv.ParseBool(value)
+
+			if err != nil {
+				return nil, fmt.Errorf("attribute %s must be a boolean", key)
+			}
+
+			raw = b
+		}
+
+		normalized, err := d.parse(raw)
+
+		if err != nil {
+			return nil, fmt.Errorf("attribute %s %s", key, err.Error())
+		}
+
+		filter[key] = normalized
+	}
+
+	return filter, nil
+}
+
+// Claims picks the values of the attributes marked to be included in tokens.
+func (s Schema) Claims(metadata map[string]interface{}) map[string]interface{} {
+	claims := make(map[string]interface{})
+
+	for _, d := range s {
+		if value, ok := metadata[d.Key]; d.Claim && ok {
+			claims[d.Key] = value
+		}
+	}
+
+	return claims
+}
+
+func (d *Definition) normalize(value interface{}) (interface{}, error) {
+	normalized, err := d.parse(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := normalized.(type) {
+	case string:
+		if d.Min != nil && float64(len([]rune(v))) < *d.Min {
+			return nil, fmt.Errorf("must be at least %v characters long", *d.Min)
+		}
+
+		if d.Max != nil && float64(len([]rune(v))) > *d.Max {
+			return nil, fmt.Errorf("must be at most %v characters long", *d.Max)
+		}
+
+		if len(d.Pattern) != 0 && d.Type == TypeString {
+			pattern, err := d.compiledPattern()
+
+			if err != nil {
+				return nil, fmt.Errorf("has an invalid pattern")
+			}
+
+			if !pattern.MatchString(v) {
+				return nil, fmt.Errorf("must match %s", d.Pattern)
+			}
+		}
+	case float64:
+		if d.Min != nil && v < *d.Min {
+			return nil, fmt.Errorf("must be at least %v", *d.Min)
+		}
+
+		if d.Max != nil && v > *d.Max {
+			return nil, fmt.Errorf("must be at most %v", *d.Max)
+		}
+	}
+
+	return normalized, nil
+}
+
+// compiledPattern compiles the pattern once for the definition.
+func (d *Definition) compiledPattern() (*regexp.Regexp, error) {
+	if d.pattern != nil {
+		return d.pattern, nil
+	}
+
+	pattern, err := regexp.Compile(d.Pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.pattern = pattern
+
+	return pattern, nil
+}
+
+// parse checks the type of the value and converts it into its stored form.
+func (d *Definition) parse(value interface{}) (interface{}, error) {
+	switch d.Type {
+	case TypeString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+
+		return nil, fmt.Errorf("must be a string")
+	case TypeNumber:
+		if n, ok := value.(float64); ok && !math.IsNaN(n) && !math.IsInf(n, 0) {
+			return n, nil
+		}
+
+		return nil, fmt.Errorf("must be a number")
+	case TypeBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+
+		return nil, fmt.Errorf("must be a boolean")
+	case TypeEnum:
+		if s, ok := value.(string); ok {
+			for _, allowed := range d.Values {
+				if s == allowed {
+					return s, nil
+				}
+			}
+		}
+
+		return nil, fmt.Errorf("must be one of %s", strings.Join(d.Values, ", "))
+	case TypeDate:
+		if s, ok := value.(string); ok {
+			if t, err := time.Parse(DateLayout, s); err == nil {
+				return t.Format(DateLayout), nil
+			}
+		}
+
+		return nil, fmt.Errorf("must be a date formatted as YYYY-MM-DD")
+	}
+
+	return nil, fmt.Errorf("has unknown type %s", d.Type)
+}
@@ -0,0 +1,73 @@
+package attribute
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRequiresAttributes(t *testing.T) {
+	schema := Schema{
+		{Key: "department", Type: TypeString, Required: true},
+		{Key: "level", Type: TypeNumber},
+	}
+
+	var validationError *ValidationError
+
+	for _, values := range []map[string]interface{}{nil, {}, {"level": 3.0}, {"department": nil}} {
+		_, err := schema.Validate(values)
+
+		if !errors.As(err, &validationError) || validationError.Violations["department"] != "is required" {
+			t.Errorf("Validate(%v) error = %v, want department to be required", values, err)
+		}
+	}
+
+	metadata, err := schema.Validate(map[string]interface{}{"department": "sales"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if metadata["department"] != "sales" {
+		t.Errorf("metadata = %v", metadata)
+	}
+}
+
+func TestCheckCompilesPattern(t *testing.T) {
+	schema := Schema{{Key: "code", Type: TypeString, Pattern: `^[A-Z]{3}$`}}
+
+	if err := schema.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	compiled := schema[0].pattern
+
+	if compiled == nil {
+		t.Fatal("pattern is not compiled")
+	}
+
+	for value, valid := range map[string]bool{"ABC": true, "abc": false, "ABCD": false} {
+		_, err := schema.Validate(map[string]interface{}{"code": value})
+
+		if (err == nil) != valid {
+			t.Errorf("Validate(%q) error = %v, want valid %v", value, err, valid)
+		}
+	}
+
+	if schema[0].pattern != compiled {
+		t.Error("pattern was compiled again")
+	}
+}
+
+func TestInvalidStoredPatternIsAViolation(t *testing.T) {
+	schema := Schema{{Key: "code", Type: TypeString, Pattern: `(`}}
+
+	if err := schema.Check(); err == nil {
+		t.Error("Check accepted an invalid pattern")
+	}
+
+	var validationError *ValidationError
+
+	if _, err := schema.Validate(map[string]interface{}{"code": "ABC"}); !errors.As(err, &validationError) {
+		t.Errorf("Validate error = %v, want a validation error", err)
+	}
+}
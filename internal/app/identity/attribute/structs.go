@@ -0,0 +1,49 @@
+package attribute
+
+import "regexp"
+
+type Type string
+
+const (
+	TypeString Type = "STRING"
+	TypeNumber Type = "NUMBER"
+	TypeBool   Type = "BOOL"
+	TypeEnum   Type = "ENUM"
+	TypeDate   Type = "DATE"
+)
+
+// DateLayout is the format dates are accepted and stored in. Stored dates
+// compare lexically in chronological order.
+const DateLayout = "2006-01-02"
+
+// Definition describes one custom attribute organizations can set on their
+// users.
+type Definition struct {
+	Key         string   `json:"key" bson:"key"`
+	Type        Type     `json:"type" bson:"type"`
+	Description string   `json:"description" bson:"description"`
+	Required    bool     `json:"required" bson:"required"`
+	Values      []string `json:"values,omitempty" bson:"values,omitempty"`
+	Pattern     string   `json:"pattern,omitempty" bson:"pattern,omitempty"`
+	Min         *float64 `json:"min,omitempty" bson:"min,omitempty"`
+	Max         *float64 `json:"max,omitempty" bson:"max,omitempty"`
+	Claim       bool     `json:"claim" bson:"claim"`
+
+	// pattern is Pattern compiled, set when the schema is checked or on first
+	// use after the definition is loaded.
+	pattern *regexp.Regexp
+}
+
+// Schema is the set of attributes of an organization.
+type Schema []*Definition
+
+// ValidationError lists every attribute value that did not match the schema.
+type ValidationError struct {
+	Violations map[string]string
+}
+
+type ValidationResponse struct {
+	Success    bool              `json:"success"`
+	Message    string            `json:"message"`
+	Violations map[string]string `json:"violations"`
+}
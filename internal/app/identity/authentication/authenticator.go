@@ -2,21 +2,30 @@ package authentication
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/superstackhq/identity/pkg/actor"
 )
 
+type SessionValidator interface {
+	Active(ctx context.Context, sessionID string, userID string) (bool, error)
+}
+
 type Authenticator struct {
-	jwtSigningKey []byte
+	jwtSigningKey    []byte
+	sessionValidator SessionValidator
 }
 
-func NewAuthenticator(jwtSigningKey string) *Authenticator {
+func NewAuthenticator(jwtSigningKey string, sessionValidator SessionValidator) *Authenticator {
 	return &Authenticator{
-		jwtSigningKey: []byte(jwtSigningKey),
+		jwtSigningKey:    []byte(jwtSigningKey),
+		sessionValidator: sessionValidator,
 	}
 }
 
@@ -25,13 +34,33 @@ const (
 	ApiKey      = "ApiKey"
 )
 
-func (a *Authenticator) GenerateToken(userID string, organizationID string, admin bool) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+const (
+	PasswordChangeTokenValidity = 15 * time.Minute
+
+	keyIDLength = 16
+)
+
+// actorKey holds the actor identified for a request in the gin context, so
+// that the middleware and the handler do not each look up the session.
+const actorKey = "authentication.actor"
+
+// GenerateToken issues an access token. Custom attributes are nested under a
+// metadata claim so they cannot shadow the registered ones.
+func (a *Authenticator) GenerateToken(userID string, organizationID string, admin bool, metadata map[string]interface{}, sessionID string, expiresAt time.Time) (string, error) {
+	claims := jwt.MapClaims{
 		"id":              userID,
 		"admin":           admin,
 		"organization_id": organizationID,
+		"sid":             sessionID,
+		"exp":             expiresAt.Unix(),
 		"iss":             "superstack",
-	})
+	}
+
+	if len(metadata) != 0 {
+		claims["metadata"] = metadata
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, err := token.SignedString(a.jwtSigningKey)
 
@@ -42,32 +71,95 @@ func (a *Authenticator) GenerateToken(userID string, organizationID string, admi
 	return tokenString, nil
 }
 
+func (a *Authenticator) GeneratePasswordChangeToken(userID string, organizationID string, sessionID string, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"id":              userID,
+		"admin":           false,
+		"organization_id": organizationID,
+		"scope":           string(ScopePasswordChange),
+		"sid":             sessionID,
+		"exp":             expiresAt.Unix(),
+		"iss":             "superstack",
+	})
+
+	return token.SignedString(a.jwtSigningKey)
+}
+
 func (a *Authenticator) ValidateContext(c *gin.Context, ctx context.Context) (*AuthenticatedActor, error) {
+	au, err := a.validateContext(c, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if au.Scope != ScopeFull {
+		return nil, fmt.Errorf("password change required")
+	}
+
+	return au, nil
+}
+
+func (a *Authenticator) ValidatePasswordChangeContext(c *gin.Context, ctx context.Context) (*AuthenticatedActor, error) {
+	au, err := a.validateContext(c, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if au.Scope != ScopeFull && au.Scope != ScopePasswordChange {
+		return nil, fmt.Errorf("invalid access token")
+	}
+
+	return au, nil
+}
+
+func (a *Authenticator) Identify(c *gin.Context, ctx context.Context) (*AuthenticatedActor, error) {
+	return a.validateContext(c, ctx)
+}
+
+func (a *Authenticator) validateContext(c *gin.Context, ctx context.Context) (*AuthenticatedActor, error) {
+	if au, ok := c.Get(actorKey); ok {
+		return au.(*AuthenticatedActor), nil
+	}
+
 	tokenType, token, err := a.extractToken(c)
 
 	if err != nil {
 		return nil, err
 	}
 
+	var au *AuthenticatedActor
+
 	switch tokenType {
 	case BearerToken:
-		return a.validateBearerToken(token)
+		au, err = a.validateBearerToken(ctx, token)
 	case ApiKey:
-		return a.validateApiKey(ctx, token)
+		au, err = a.validateApiKey(ctx, token)
 	default:
 		return nil, fmt.Errorf("invalid token type")
 	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(actorKey, au)
+
+	return au, nil
 }
 
 func (a *Authenticator) validateApiKey(ctx context.Context, accessKey string) (*AuthenticatedActor, error) {
+	sum := sha256.Sum256([]byte(accessKey))
+
 	return &AuthenticatedActor{
 		ActorID:       "", // TODO
 		ActorType:     actor.TypeApiKey,
 		HasFullAccess: false,
+		KeyID:         hex.EncodeToString(sum[:keyIDLength]),
 	}, nil
 }
 
-func (a *Authenticator) validateBearerToken(tokenString string) (*AuthenticatedActor, error) {
+func (a *Authenticator) validateBearerToken(ctx context.Context, tokenString string) (*AuthenticatedActor, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		return a.jwtSigningKey, nil
 	})
@@ -113,11 +205,41 @@ func (a *Authenticator) validateBearerToken(tokenString string) (*AuthenticatedA
 			return nil, fmt.Errorf("invalid access token")
 		}
 
+		scope := ScopeFull
+
+		if s, ok := claims["scope"]; ok {
+			scopeString, ok := s.(string)
+
+			if !ok {
+				return nil, fmt.Errorf("invalid access token")
+			}
+
+			scope = Scope(scopeString)
+		}
+
+		sessionID, ok := claims["sid"].(string)
+
+		if !ok {
+			return nil, fmt.Errorf("invalid access token")
+		}
+
+		active, err := a.sessionValidator.Active(ctx, sessionID, userIDString)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !active {
+			return nil, fmt.Errorf("session has expired or was revoked")
+		}
+
 		return &AuthenticatedActor{
 			ActorID:        userIDString,
 			ActorType:      actor.TypeUser,
 			OrganizationID: organizationIDString,
-			HasFullAccess:  adminBool,
+			HasFullAccess:  adminBool && scope == ScopeFull,
+			Scope:          scope,
+			SessionID:      sessionID,
 		}, nil
 	} else {
 		return nil, fmt.Errorf("invalid access token")
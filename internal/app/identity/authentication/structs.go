@@ -9,4 +9,15 @@ type AuthenticatedActor struct {
 	ActorID        string
 	OrganizationID string
 	HasFullAccess  bool
+	Scope          Scope
+	SessionID      string
+	// KeyID tells API keys apart while they share an empty ActorID.
+	KeyID string
 }
+
+type Scope string
+
+const (
+	ScopeFull           Scope = ""
+	ScopePasswordChange Scope = "password_change"
+)
@@ -0,0 +1,168 @@
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+var bloomMagic = [4]byte{'H', 'I', 'B', 'F'}
+
+type BloomFilter struct {
+	bits   []uint64
+	size   uint64
+	hashes uint32
+}
+
+func NewBloomFilter(expectedItems uint64, falsePositiveRate float64) *BloomFilter {
+	if expectedItems == 0 {
+		expectedItems = 1
+	}
+
+	size := uint64(math.Ceil(-float64(expectedItems) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint32(math.Max(1, math.Round(float64(size)/float64(expectedItems)*math.Ln2)))
+
+	return &BloomFilter{
+		bits:   make([]uint64, (size+63)/64),
+		size:   size,
+		hashes: hashes,
+	}
+}
+
+func LoadBloomFilter(path string) (*BloomFilter, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return ReadBloomFilter(bufio.NewReader(file))
+}
+
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	var magic [4]byte
+
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+
+	if magic != bloomMagic {
+		return nil, errors.New("invalid bloom filter file")
+	}
+
+	filter := &BloomFilter{}
+
+	if err := binary.Read(r, binary.LittleEndian, &filter.size); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &filter.hashes); err != nil {
+		return nil, err
+	}
+
+	filter.bits = make([]uint64, (filter.size+63)/64)
+
+	if err := binary.Read(r, binary.LittleEndian, filter.bits); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	writer := &countingWriter{writer: w}
+
+	if _, err := writer.Write(bloomMagic[:]); err != nil {
+		return writer.count, err
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, f.size); err != nil {
+		return writer.count, err
+	}
+
+	if err := binary.Write(writer, binary.LittleEndian, f.hashes); err != nil {
+		return writer.count, err
+	}
+
+	err := binary.Write(writer, binary.LittleEndian, f.bits)
+
+	return writer.count, err
+}
+
+func (f *BloomFilter) AddHash(hash string) error {
+	digest, err := decodeHash(hash)
+
+	if err != nil {
+		return err
+	}
+
+	for _, position := range f.positions(digest) {
+		f.bits[position/64] |= 1 << (position % 64)
+	}
+
+	return nil
+}
+
+func (f *BloomFilter) ContainsHash(hash string) (bool, error) {
+	digest, err := decodeHash(hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, position := range f.positions(digest) {
+		if f.bits[position/64]&(1<<(position%64)) == 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (f *BloomFilter) Breached(password string) (bool, error) {
+	return f.ContainsHash(Hash(password))
+}
+
+func (f *BloomFilter) positions(digest []byte) []uint64 {
+	h1 := binary.LittleEndian.Uint64(digest[0:8])
+	h2 := binary.LittleEndian.Uint64(digest[8:16])
+	positions := make([]uint64, f.hashes)
+
+	for i := uint32(0); i < f.hashes; i++ {
+		positions[i] = (h1 + uint64(i)*h2) % f.size
+	}
+
+	return positions
+}
+
+func decodeHash(hash string) ([]byte, error) {
+	digest, err := hex.DecodeString(hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(digest) != sha1.Size {
+		return nil, errors.New("invalid sha1 hash")
+	}
+
+	return digest, nil
+}
+
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,27 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+)
+
+type Checker interface {
+	Breached(password string) (bool, error)
+}
+
+type NopChecker struct {
+}
+
+func NewNopChecker() *NopChecker {
+	return &NopChecker{}
+}
+
+func (c *NopChecker) Breached(password string) (bool, error) {
+	return false, nil
+}
+
+func Hash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,76 @@
+package breach
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	prefixLength = 5
+)
+
+type RangeChecker struct {
+	directory string
+}
+
+func NewRangeChecker(directory string) (*RangeChecker, error) {
+	info, err := os.Stat(directory)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, errors.New("breached password range dataset must be a directory")
+	}
+
+	return &RangeChecker{
+		directory: directory,
+	}, nil
+}
+
+func (c *RangeChecker) Breached(password string) (bool, error) {
+	hash := Hash(password)
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	file, err := c.open(prefix)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) < len(suffix) {
+			continue
+		}
+
+		if strings.EqualFold(line[:len(suffix)], suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+func (c *RangeChecker) open(prefix string) (*os.File, error) {
+	file, err := os.Open(filepath.Join(c.directory, prefix+".txt"))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(c.directory, prefix))
+	}
+
+	return file, err
+}
@@ -0,0 +1,90 @@
+package erasure
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superstackhq/common/api"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/pkg/actor"
+)
+
+type Handler struct {
+	router        *gin.Engine
+	authenticator *authentication.Authenticator
+	manager       *Manager
+}
+
+func NewHandler(router *gin.Engine, authenticator *authentication.Authenticator, manager *Manager) *Handler {
+	return &Handler{
+		router:        router,
+		authenticator: authenticator,
+		manager:       manager,
+	}
+}
+
+func (h *Handler) Register() {
+	h.router.POST("/api/v1/users/me/erasure", h.eraseSelf)
+	h.router.POST("/api/v1/users/:userID/erasure", h.erase)
+}
+
+func (h *Handler) eraseSelf(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 30*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	record, err := h.manager.Erase(ctx, a.ActorID, a)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+func (h *Handler) erase(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 30*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	record, err := h.manager.Erase(ctx, userID, a)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
@@ -0,0 +1,243 @@
+package erasure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/importer"
+	"github.com/superstackhq/identity/internal/app/identity/invitation"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
+	"github.com/superstackhq/identity/internal/app/identity/organization"
+	"github.com/superstackhq/identity/internal/app/identity/session"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/internal/app/identity/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.uber.org/zap"
+)
+
+const (
+	pseudonymLength = 12
+)
+
+type Manager struct {
+	userManager         *user.Manager
+	membershipManager   *membership.Manager
+	organizationManager *organization.Manager
+	sessionManager      *session.Manager
+	tokenManager        *token.Manager
+	invitationManager   *invitation.Manager
+	importManager       *importer.Manager
+	config              *Config
+}
+
+func NewManager(userManager *user.Manager, membershipManager *membership.Manager, organizationManager *organization.Manager, sessionManager *session.Manager, tokenManager *token.Manager, invitationManager *invitation.Manager, importManager *importer.Manager, config *Config) *Manager {
+	return &Manager{
+		userManager:         userManager,
+		membershipManager:   membershipManager,
+		organizationManager: organizationManager,
+		sessionManager:      sessionManager,
+		tokenManager:        tokenManager,
+		invitationManager:   invitationManager,
+		importManager:       importManager,
+		config:              config,
+	}
+}
+
+// Erase removes or pseudonymises all personal data of the user on request of
+// the actor. Users can erase themselves, while admins can only erase users
+// that do not belong to any other organization.
+func (m *Manager) Erase(ctx context.Context, userID string, actor *authentication.AuthenticatedActor) (*Record, error) {
+	owner, err := m.organizationManager.OwnsAny(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if owner {
+		return nil, fmt.Errorf("user %s owns an organization and must transfer ownership first", userID)
+	}
+
+	if userID != actor.ActorID {
+		err = m.checkErasable(ctx, userID, actor.OrganizationID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m.erase(ctx, userID, ReasonRequest, actor)
+}
+
+// Purge erases the users that were deleted longer than the retention period
+// ago.
+func (m *Manager) Purge(ctx context.Context) (int, error) {
+	users, err := m.userManager.ListDeleted(ctx, time.Now().UTC().Add(-m.config.Retention))
+
+	if err != nil {
+		return 0, err
+	}
+
+	for i, u := range users {
+		_, err = m.erase(ctx, u.ID.Hex(), ReasonRetention, &authentication.AuthenticatedActor{})
+
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(users), nil
+}
+
+// RunPurge purges deleted users every purge interval until the context is
+// done.
+func (m *Manager) RunPurge(ctx context.Context) {
+	ticker := time.NewTicker(m.config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := m.Purge(ctx)
+
+			if err != nil {
+				zap.L().Error("error while purging deleted users", zap.Int("purged", purged), zap.Error(err))
+			} else if purged != 0 {
+				zap.L().Info("purged deleted users", zap.Int("purged", purged))
+			}
+		}
+	}
+}
+
+func (m *Manager) checkErasable(ctx context.Context, userID string, organizationID string) error {
+	memberships, err := m.membershipManager.ListByUser(ctx, userID)
+
+	if err != nil {
+		return err
+	}
+
+	for _, ms := range memberships {
+		if ms.OrganizationID != organizationID {
+			return fmt.Errorf("user %s belongs to other organizations and must request erasure themselves", userID)
+		}
+	}
+
+	if len(memberships) == 0 {
+		_, err = m.membershipManager.GetDeleted(ctx, userID, organizationID)
+	}
+
+	return err
+}
+
+func (m *Manager) erase(ctx context.Context, userID string, reason Reason, actor *authentication.AuthenticatedActor) (*Record, error) {
+	pseudonym, err := newPseudonym()
+
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := m.userManager.PrepareErasure(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The identity goes last, so that an erasure that fails halfway can be
+	// retried until nothing refers to the user anymore.
+	err = m.userManager.Pseudonymise(ctx, userID, pseudonym)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.importManager.Pseudonymise(ctx, userID, u.Email, pseudonym)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.organizationManager.Pseudonymise(ctx, userID, pseudonym)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.invitationManager.Pseudonymise(ctx, userID, pseudonym)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.sessionManager.Erase(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.tokenManager.Erase(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = mgm.Coll(&Record{}).UpdateMany(ctx, bson.M{
+		"requester_id": userID,
+	}, bson.M{
+		"$set": bson.M{"requester_id": pseudonym},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.membershipManager.Erase(ctx, userID, pseudonym)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.userManager.Erase(ctx, u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{
+		UserID:         userID,
+		Pseudonym:      pseudonym,
+		Reason:         reason,
+		RequesterType:  actor.ActorType,
+		RequesterID:    actor.ActorID,
+		OrganizationID: actor.OrganizationID,
+	}
+
+	if actor.ActorID == userID {
+		record.RequesterID = pseudonym
+	}
+
+	err = mgm.Coll(record).CreateWithCtx(ctx, record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func newPseudonym() (string, error) {
+	raw := make([]byte, pseudonymLength)
+
+	_, err := rand.Read(raw)
+
+	if err != nil {
+		return "", err
+	}
+
+	return "erased-" + hex.EncodeToString(raw), nil
+}
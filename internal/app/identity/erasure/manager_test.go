@@ -0,0 +1,172 @@
+package erasure
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/breach"
+	"github.com/superstackhq/identity/internal/app/identity/importer"
+	"github.com/superstackhq/identity/internal/app/identity/invitation"
+	"github.com/superstackhq/identity/internal/app/identity/mail"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
+	"github.com/superstackhq/identity/internal/app/identity/organization"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/session"
+	"github.com/superstackhq/identity/internal/app/identity/testdb"
+	"github.com/superstackhq/identity/internal/app/identity/throttle"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/internal/app/identity/user"
+	"github.com/superstackhq/identity/pkg/actor"
+	userapi "github.com/superstackhq/identity/pkg/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// outbox keeps the messages sent instead of delivering them.
+type outbox struct {
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, message *mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, message)
+
+	return nil
+}
+
+func newTestManager(t *testing.T) (context.Context, *Manager, *user.Manager, *invitation.Manager) {
+	ctx := testdb.Setup(t)
+
+	sessionManager := session.NewManager()
+	membershipManager := membership.NewManager()
+	organizationManager := organization.NewManager(membershipManager)
+	tokenManager := token.NewManager()
+	hasher := password.NewHasher(password.NewBcrypt(4))
+	sent := &outbox{}
+	userManager := user.NewManager(organizationManager, membershipManager, authentication.NewAuthenticator("secret", sessionManager),
+		breach.NewNopChecker(), hasher, tokenManager, throttle.NewManager(&throttle.Config{}), sessionManager, sent, &user.Config{
+			WebURL:          "http://localhost",
+			SessionDuration: time.Hour,
+			Retention:       time.Hour,
+		})
+	invitationManager := invitation.NewManager(userManager, organizationManager, tokenManager, sent, &invitation.Config{
+		WebURL:   "http://localhost",
+		Validity: time.Hour,
+	})
+
+	for _, ensure := range []func(context.Context) error{
+		membershipManager.EnsureIndexes,
+		organizationManager.EnsureIndexes,
+		userManager.EnsureIndexes,
+	} {
+		if err := ensure(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return ctx, NewManager(userManager, membershipManager, organizationManager, sessionManager, tokenManager, invitationManager,
+		importer.NewManager(userManager, invitationManager, hasher), &Config{Retention: time.Hour}), userManager, invitationManager
+}
+
+// rejectPseudonyms makes MongoDB refuse to pseudonymise invitations until
+// the returned function is called.
+func rejectPseudonyms(ctx context.Context, t *testing.T) func() {
+	t.Helper()
+
+	_, _, db, err := mgm.DefaultConfigs()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := mgm.Coll(&invitation.Invitation{}).Name()
+
+	collMod := func(validator bson.M) {
+		err := db.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: name},
+			{Key: "validator", Value: validator},
+		}).Err()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collMod(bson.M{"user_id": bson.M{"$not": primitive.Regex{Pattern: "^erased-"}}})
+
+	return func() {
+		collMod(bson.M{})
+	}
+}
+
+func TestErasureCanBeRetriedAfterPartialFailure(t *testing.T) {
+	ctx, m, userManager, invitationManager := newTestManager(t)
+
+	owner, err := userManager.SignUp(ctx, &userapi.SignUpRequest{
+		Username:         "alice",
+		Password:         "Correct-Horse-9-Battery",
+		OrganizationName: "Acme",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &authentication.AuthenticatedActor{
+		ActorType:      actor.TypeUser,
+		ActorID:        owner.ID.Hex(),
+		OrganizationID: owner.OrganizationID,
+		HasFullAccess:  true,
+	}
+
+	i, err := invitationManager.Invite(ctx, &userapi.AdditionRequest{Username: "bob", Email: "bob@example.com"}, admin)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restore := rejectPseudonyms(ctx, t)
+
+	if _, err = m.Erase(ctx, i.UserID, admin); err == nil {
+		t.Fatal("erasure succeeded although invitations could not be pseudonymised")
+	}
+
+	if _, err = userManager.PrepareErasure(ctx, i.UserID); err != nil {
+		t.Fatalf("identity is gone after a failed erasure: %v", err)
+	}
+
+	restore()
+
+	record, err := m.Erase(ctx, i.UserID, admin)
+
+	if err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+
+	if _, err = userManager.PrepareErasure(ctx, i.UserID); err == nil {
+		t.Error("identity survived the erasure")
+	}
+
+	for name, model := range map[string]mgm.Model{"invitations": &invitation.Invitation{}, "memberships": &membership.Membership{}, "tokens": &token.Token{}} {
+		count, err := mgm.Coll(model).CountDocuments(ctx, bson.M{"user_id": i.UserID})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if count != 0 {
+			t.Errorf("%d %s still refer to the user", count, name)
+		}
+	}
+
+	if record.UserID != i.UserID {
+		t.Errorf("record is for %s, want %s", record.UserID, i.UserID)
+	}
+}
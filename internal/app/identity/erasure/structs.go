@@ -0,0 +1,32 @@
+package erasure
+
+import (
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/pkg/actor"
+)
+
+type Reason string
+
+const (
+	ReasonRequest   Reason = "REQUEST"
+	ReasonRetention Reason = "RETENTION"
+)
+
+type Config struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+// Record proves that the personal data of a user was erased. The user is
+// referred to by their pseudonym everywhere else from then on.
+type Record struct {
+	mgm.DefaultModel `bson:",inline"`
+	UserID           string     `json:"user_id" bson:"user_id"`
+	Pseudonym        string     `json:"pseudonym" bson:"pseudonym"`
+	Reason           Reason     `json:"reason" bson:"reason"`
+	RequesterType    actor.Type `json:"requester_type" bson:"requester_type"`
+	RequesterID      string     `json:"requester_id" bson:"requester_id"`
+	OrganizationID   string     `json:"organization_id" bson:"organization_id"`
+}
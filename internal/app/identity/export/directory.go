@@ -0,0 +1,190 @@
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superstackhq/identity/internal/app/identity/user"
+	userapi "github.com/superstackhq/identity/pkg/user"
+)
+
+const (
+	metadataPrefix = "metadata."
+
+	// formulaPrefixes are the characters that make spreadsheets read a cell
+	// as a formula.
+	formulaPrefixes = "=+-@\t\r"
+)
+
+// ParseFields validates a comma separated list of fields, defaulting to all
+// of them. Custom attributes are selected as metadata.<key>.
+func ParseFields(value string) ([]string, error) {
+	if len(strings.TrimSpace(value)) == 0 {
+		return Fields, nil
+	}
+
+	known := make(map[string]bool, len(Fields))
+
+	for _, f := range Fields {
+		known[f] = true
+	}
+
+	var fields []string
+
+	for _, f := range strings.Split(value, ",") {
+		f = strings.ToLower(strings.TrimSpace(f))
+
+		if !known[f] && !strings.HasPrefix(f, metadataPrefix) {
+			return nil, fmt.Errorf("unknown field %s", f)
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// ExportDirectory writes the selected fields of every user of the
+// organization matching the list request to w, one record per user. Users are
+// streamed from the database, so nothing is written until the first batch
+// has been read.
+func (m *Manager) ExportDirectory(ctx context.Context, w io.Writer, organizationID string, format Format, fields []string, listRequest *userapi.ListRequest) error {
+	var write func(*user.Member) error
+	var finish func() error
+
+	switch format {
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		headerWritten := false
+
+		writeHeader := func() error {
+			if headerWritten {
+				return nil
+			}
+
+			headerWritten = true
+			return writer.Write(fields)
+		}
+
+		write = func(member *user.Member) error {
+			if err := writeHeader(); err != nil {
+				return err
+			}
+
+			record := make([]string, len(fields))
+
+			for i, f := range fields {
+				record[i] = csvValue(fieldValue(member, f))
+			}
+
+			return writer.Write(record)
+		}
+
+		finish = func() error {
+			if err := writeHeader(); err != nil {
+				return err
+			}
+
+			writer.Flush()
+			return writer.Error()
+		}
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+
+		write = func(member *user.Member) error {
+			record := make(map[string]interface{}, len(fields))
+
+			for _, f := range fields {
+				record[f] = fieldValue(member, f)
+			}
+
+			return encoder.Encode(record)
+		}
+
+		finish = func() error {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported export format %s", format)
+	}
+
+	err := m.userManager.Stream(ctx, organizationID, listRequest, write)
+
+	if err != nil {
+		return err
+	}
+
+	return finish()
+}
+
+func fieldValue(member *user.Member, field string) interface{} {
+	if strings.HasPrefix(field, metadataPrefix) {
+		return member.Metadata[strings.TrimPrefix(field, metadataPrefix)]
+	}
+
+	switch field {
+	case "id":
+		return member.ID.Hex()
+	case "username":
+		return member.Username
+	case "email":
+		return member.Email
+	case "email_verified":
+		return member.EmailVerified
+	case "display_name":
+		return member.DisplayName
+	case "given_name":
+		return member.GivenName
+	case "family_name":
+		return member.FamilyName
+	case "locale":
+		return member.Locale
+	case "timezone":
+		return member.Timezone
+	case "admin":
+		return member.Admin
+	case "status":
+		return member.Status
+	case "creator_type":
+		return member.CreatorType
+	case "creator_id":
+		return member.CreatorID
+	case "created_at":
+		return member.CreatedAt
+	case "updated_at":
+		return member.UpdatedAt
+	}
+
+	return nil
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case nil:
+		return ""
+	}
+
+	return escapeFormula(fmt.Sprint(value))
+}
+
+// escapeFormula keeps spreadsheets from evaluating a cell as a formula by
+// prefixing it with a quote.
+func escapeFormula(value string) string {
+	if len(value) != 0 && strings.ContainsRune(formulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
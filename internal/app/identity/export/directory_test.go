@@ -0,0 +1,35 @@
+package export
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCSVValueEscapesFormulas(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"alice", "alice"},
+		{"", ""},
+		{nil, ""},
+		{"=HYPERLINK(\"http://example.com\")", "'=HYPERLINK(\"http://example.com\")"},
+		{"+1+1", "'+1+1"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+		{-1.5, "-1.5"},
+		{true, "true"},
+		{now, "2024-01-02T03:04:05Z"},
+	}
+
+	for _, test := range tests {
+		if got := csvValue(test.value); got != test.want {
+			t.Errorf("csvValue(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superstackhq/common/api"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/pkg/actor"
+	"github.com/superstackhq/identity/pkg/user"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	router        *gin.Engine
+	authenticator *authentication.Authenticator
+	manager       *Manager
+}
+
+func NewHandler(router *gin.Engine, authenticator *authentication.Authenticator, manager *Manager) *Handler {
+	return &Handler{
+		router:        router,
+		authenticator: authenticator,
+		manager:       manager,
+	}
+}
+
+func (h *Handler) Register() {
+	h.router.GET("/api/v1/users/me/export", h.exportSelf)
+	h.router.GET("/api/v1/users/:userID/export", h.export)
+	h.router.GET("/api/v1/users/export", h.exportDirectory)
+}
+
+func (h *Handler) exportSelf(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 30*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	h.write(c, ctx, a.ActorID, a)
+}
+
+func (h *Handler) export(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 30*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	h.write(c, ctx, userID, a)
+}
+
+func (h *Handler) write(c *gin.Context, ctx context.Context, userID string, a *authentication.AuthenticatedActor) {
+	archive, err := h.manager.Export(ctx, userID, a)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"user-%s-export.zip\"", userID))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+func (h *Handler) exportDirectory(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 10*time.Minute)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	var request user.ListRequest
+	err = c.ShouldBindQuery(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	request.Metadata = c.QueryMap("metadata")
+
+	fields, err := ParseFields(c.Query("fields"))
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	format := Format(strings.ToLower(c.DefaultQuery("format", string(FormatCSV))))
+	contentType := "text/csv"
+
+	switch format {
+	case FormatCSV:
+	case FormatJSONL:
+		contentType = "application/x-ndjson"
+	default:
+		api.ErrorMessage(c, http.StatusBadRequest, "format must be csv or jsonl")
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"users-%s.%s\"", a.OrganizationID, format))
+
+	err = h.manager.ExportDirectory(ctx, c.Writer, a.OrganizationID, format, fields, &request)
+
+	if err == nil {
+		return
+	}
+
+	// Once rows have been sent the status can no longer change, so the
+	// response is cut short instead.
+	if c.Writer.Written() {
+		zap.L().Error("error while exporting users", zap.String("organization", a.OrganizationID), zap.Error(err))
+		c.Abort()
+		return
+	}
+
+	c.Header("Content-Type", "")
+	c.Header("Content-Disposition", "")
+	api.Error(c, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,146 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/invitation"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
+	"github.com/superstackhq/identity/internal/app/identity/session"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/internal/app/identity/user"
+	actorapi "github.com/superstackhq/identity/pkg/actor"
+)
+
+type Manager struct {
+	userManager       *user.Manager
+	membershipManager *membership.Manager
+	sessionManager    *session.Manager
+	tokenManager      *token.Manager
+	invitationManager *invitation.Manager
+}
+
+func NewManager(userManager *user.Manager, membershipManager *membership.Manager, sessionManager *session.Manager, tokenManager *token.Manager, invitationManager *invitation.Manager) *Manager {
+	return &Manager{
+		userManager:       userManager,
+		membershipManager: membershipManager,
+		sessionManager:    sessionManager,
+		tokenManager:      tokenManager,
+		invitationManager: invitationManager,
+	}
+}
+
+// Export builds a zip archive of JSON files holding everything stored about
+// the user. Users can export themselves across organizations, while admins
+// can export what their organization holds about any of its users.
+func (m *Manager) Export(ctx context.Context, userID string, actor *authentication.AuthenticatedActor) ([]byte, error) {
+	organizationID := ""
+
+	if actor.ActorType != actorapi.TypeUser || userID != actor.ActorID {
+		_, err := m.userManager.GetByOrganization(ctx, userID, actor.OrganizationID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		organizationID = actor.OrganizationID
+	}
+
+	profile, err := m.userManager.Get(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := m.membershipManager.ListAllByUser(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	logins, err := m.sessionManager.ListAllLogins(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := m.sessionManager.ListAll(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := m.tokenManager.ListByUser(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	invitations, err := m.invitationManager.ListByUser(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", profile},
+		{"memberships.json", memberships},
+		{"logins.json", logins},
+		{"sessions.json", sessions},
+		{"tokens.json", tokens},
+		{"invitations.json", invitations},
+	}
+
+	manifest := &Manifest{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		GeneratedAt:    time.Now().UTC(),
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	for _, file := range files {
+		err = writeJSON(archive, file.name, file.content)
+
+		if err != nil {
+			return nil, err
+		}
+
+		manifest.Files = append(manifest.Files, file.name)
+	}
+
+	err = writeJSON(archive, "manifest.json", manifest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = archive.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func writeJSON(archive *zip.Writer, name string, content interface{}) error {
+	w, err := archive.Create(name)
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(content)
+}
@@ -0,0 +1,39 @@
+package export
+
+import "time"
+
+// Manifest describes an export. Exports made by admins are limited to their
+// organization.
+type Manifest struct {
+	UserID         string    `json:"user_id"`
+	OrganizationID string    `json:"organization_id,omitempty"`
+	GeneratedAt    time.Time `json:"generated_at"`
+	Files          []string  `json:"files"`
+}
+
+type Format string
+
+const (
+	FormatCSV   Format = "csv"
+	FormatJSONL Format = "jsonl"
+)
+
+// Fields are the user fields that can be selected for a directory export, in
+// their default order.
+var Fields = []string{
+	"id",
+	"username",
+	"email",
+	"email_verified",
+	"display_name",
+	"given_name",
+	"family_name",
+	"locale",
+	"timezone",
+	"admin",
+	"status",
+	"creator_type",
+	"creator_id",
+	"created_at",
+	"updated_at",
+}
@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// auth0User is a user as exported by the Auth0 user export job, optionally
+// enriched with the password hashes Auth0 hands out on request.
+type auth0User struct {
+	Email              string                 `json:"email"`
+	Username           string                 `json:"username"`
+	Name               string                 `json:"name"`
+	Nickname           string                 `json:"nickname"`
+	GivenName          string                 `json:"given_name"`
+	FamilyName         string                 `json:"family_name"`
+	Picture            string                 `json:"picture"`
+	Locale             string                 `json:"locale"`
+	PasswordHash       string                 `json:"password_hash"`
+	LegacyPasswordHash string                 `json:"passwordHash"`
+	CustomPasswordHash *auth0CustomHash       `json:"custom_password_hash"`
+	AppMetadata        auth0Metadata          `json:"app_metadata"`
+	UserMetadata       map[string]interface{} `json:"user_metadata"`
+}
+
+type auth0CustomHash struct {
+	Algorithm string `json:"algorithm"`
+	Hash      struct {
+		Value string `json:"value"`
+	} `json:"hash"`
+}
+
+type auth0Metadata struct {
+	Roles         []string `json:"roles"`
+	Authorization struct {
+		Roles []string `json:"roles"`
+	} `json:"authorization"`
+}
+
+func parseAuth0(data []byte, adminRoles []string) ([]*Row, map[*Row]string, error) {
+	documents, err := splitJSON(data)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []*Row
+	invalid := make(map[*Row]string)
+
+	for i, document := range documents {
+		row := &Row{Number: i + 1}
+		rows = append(rows, row)
+
+		u := &auth0User{}
+
+		if err := json.Unmarshal(document, u); err != nil {
+			invalid[row] = err.Error()
+			continue
+		}
+
+		row.Username = u.Username
+		row.Email = u.Email
+		row.GivenName = u.GivenName
+		row.FamilyName = u.FamilyName
+		row.AvatarURL = u.Picture
+		row.Locale = u.Locale
+		row.Admin = hasRole(append(u.AppMetadata.Roles, u.AppMetadata.Authorization.Roles...), adminRoles)
+		row.PasswordHash = u.passwordHash()
+
+		// Auth0 fills name with the email when nothing better is known.
+		if len(u.Name) != 0 && u.Name != u.Email {
+			row.DisplayName = u.Name
+		} else {
+			row.DisplayName = u.Nickname
+		}
+
+		if locale, ok := u.UserMetadata["locale"].(string); ok && len(row.Locale) == 0 {
+			row.Locale = locale
+		}
+
+		if timezone, ok := u.UserMetadata["timezone"].(string); ok {
+			row.Timezone = timezone
+		}
+	}
+
+	return rows, invalid, nil
+}
+
+func (u *auth0User) passwordHash() string {
+	if u.CustomPasswordHash != nil {
+		switch strings.ToLower(u.CustomPasswordHash.Algorithm) {
+		case "bcrypt", "pbkdf2":
+			return u.CustomPasswordHash.Hash.Value
+		}
+	}
+
+	if len(u.PasswordHash) != 0 {
+		return u.PasswordHash
+	}
+
+	return u.LegacyPasswordHash
+}
@@ -0,0 +1,173 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superstackhq/common/api"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+)
+
+type Handler struct {
+	router        *gin.Engine
+	authenticator *authentication.Authenticator
+	manager       *Manager
+}
+
+func NewHandler(router *gin.Engine, authenticator *authentication.Authenticator, manager *Manager) *Handler {
+	return &Handler{
+		router:        router,
+		authenticator: authenticator,
+		manager:       manager,
+	}
+}
+
+func (h *Handler) Register() {
+	h.router.POST("/api/v1/users/imports", h.start)
+	h.router.GET("/api/v1/users/imports", h.list)
+	h.router.GET("/api/v1/users/imports/:jobID", h.get)
+}
+
+func (h *Handler) start(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 30*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+
+	if err != nil {
+		api.ErrorMessage(c, http.StatusBadRequest, "dry_run must be a boolean")
+		return
+	}
+
+	var adminRoles []string
+
+	for _, role := range strings.Split(c.DefaultQuery("admin_roles", "admin"), ",") {
+		if role = strings.TrimSpace(role); len(role) != 0 {
+			adminRoles = append(adminRoles, role)
+		}
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxFileSize))
+
+	if err != nil {
+		api.Error(c, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+
+	job, err := h.manager.Start(ctx, h.format(c), dryRun, adminRoles, data, a)
+
+	if errors.Is(err, ErrJobRunning) {
+		api.Error(c, http.StatusConflict, err)
+		return
+	}
+
+	if errors.Is(err, ErrTooManyJobs) {
+		api.Error(c, http.StatusTooManyRequests, err)
+		return
+	}
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	request, err := pagination.Parse(c)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.manager.List(ctx, a.OrganizationID, request)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	pagination.Respond(c, page)
+}
+
+func (h *Handler) get(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	jobID, ok := c.Params.Get("jobID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "job id is required")
+		return
+	}
+
+	job, err := h.manager.Get(ctx, jobID, a.OrganizationID)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// format takes the format from the query, falling back to the content type.
+func (h *Handler) format(c *gin.Context) Format {
+	if format := c.Query("format"); len(format) != 0 {
+		return Format(strings.ToLower(format))
+	}
+
+	if strings.Contains(c.ContentType(), "csv") {
+		return FormatCSV
+	}
+
+	return FormatJSONL
+}
@@ -0,0 +1,179 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/superstackhq/identity/internal/app/identity/password"
+)
+
+// keycloakExport is a realm export, or one of the users-N.json files
+// Keycloak splits large exports into.
+type keycloakExport struct {
+	Users []json.RawMessage `json:"users"`
+}
+
+type keycloakUser struct {
+	Username    string                `json:"username"`
+	Email       string                `json:"email"`
+	FirstName   string                `json:"firstName"`
+	LastName    string                `json:"lastName"`
+	Attributes  map[string][]string   `json:"attributes"`
+	RealmRoles  []string              `json:"realmRoles"`
+	ClientRoles map[string][]string   `json:"clientRoles"`
+	Credentials []*keycloakCredential `json:"credentials"`
+}
+
+type keycloakCredential struct {
+	Type           string `json:"type"`
+	SecretData     string `json:"secretData"`
+	CredentialData string `json:"credentialData"`
+
+	// Exports of Keycloak versions before 12 carry the hash directly.
+	HashedSaltedValue string `json:"hashedSaltedValue"`
+	Salt              string `json:"salt"`
+	HashIterations    int    `json:"hashIterations"`
+	Algorithm         string `json:"algorithm"`
+}
+
+type keycloakSecretData struct {
+	Value string `json:"value"`
+	Salt  string `json:"salt"`
+}
+
+type keycloakCredentialData struct {
+	HashIterations int    `json:"hashIterations"`
+	Algorithm      string `json:"algorithm"`
+}
+
+func parseKeycloak(data []byte, adminRoles []string) ([]*Row, map[*Row]string, error) {
+	documents, err := keycloakUsers(data)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []*Row
+	invalid := make(map[*Row]string)
+
+	for i, document := range documents {
+		row := &Row{Number: i + 1}
+		rows = append(rows, row)
+
+		u := &keycloakUser{}
+
+		if err := json.Unmarshal(document, u); err != nil {
+			invalid[row] = err.Error()
+			continue
+		}
+
+		roles := u.RealmRoles
+
+		for _, clientRoles := range u.ClientRoles {
+			roles = append(roles, clientRoles...)
+		}
+
+		row.Username = u.Username
+		row.Email = u.Email
+		row.GivenName = u.FirstName
+		row.FamilyName = u.LastName
+		row.DisplayName = strings.TrimSpace(u.FirstName + " " + u.LastName)
+		row.Locale = u.attribute("locale")
+		row.Timezone = u.attribute("timezone")
+		row.AvatarURL = u.attribute("picture")
+		row.Admin = hasRole(roles, adminRoles)
+
+		row.PasswordHash, err = u.passwordHash()
+
+		if err != nil {
+			invalid[row] = err.Error()
+		}
+	}
+
+	return rows, invalid, nil
+}
+
+func keycloakUsers(data []byte) ([]json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte("{")) {
+		export := &keycloakExport{}
+
+		if err := json.Unmarshal(data, export); err != nil {
+			return nil, err
+		}
+
+		return export.Users, nil
+	}
+
+	return splitJSON(data)
+}
+
+func (u *keycloakUser) attribute(name string) string {
+	if values := u.Attributes[name]; len(values) != 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+func (u *keycloakUser) passwordHash() (string, error) {
+	for _, credential := range u.Credentials {
+		if credential.Type == "password" {
+			return credential.passwordHash()
+		}
+	}
+
+	return "", nil
+}
+
+// passwordHash converts the credential into a hash the password hasher can
+// verify.
+func (c *keycloakCredential) passwordHash() (string, error) {
+	value, salt, iterations, algorithm := c.HashedSaltedValue, c.Salt, c.HashIterations, c.Algorithm
+
+	if len(c.SecretData) != 0 {
+		secret := &keycloakSecretData{}
+		credential := &keycloakCredentialData{}
+
+		if err := json.Unmarshal([]byte(c.SecretData), secret); err != nil {
+			return "", fmt.Errorf("invalid keycloak secret data")
+		}
+
+		if err := json.Unmarshal([]byte(c.CredentialData), credential); err != nil {
+			return "", fmt.Errorf("invalid keycloak credential data")
+		}
+
+		value, salt, iterations, algorithm = secret.Value, secret.Salt, credential.HashIterations, credential.Algorithm
+	}
+
+	switch algorithm {
+	case "bcrypt":
+		return value, nil
+	case "pbkdf2", "pbkdf2-sha256", "pbkdf2-sha512":
+		digest := strings.TrimPrefix(strings.TrimPrefix(algorithm, "pbkdf2"), "-")
+
+		if len(digest) == 0 {
+			digest = "sha1"
+		}
+
+		saltBytes, err := base64.StdEncoding.DecodeString(salt)
+
+		if err != nil {
+			return "", fmt.Errorf("invalid keycloak password salt")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(value)
+
+		if err != nil {
+			return "", fmt.Errorf("invalid keycloak password hash")
+		}
+
+		return password.EncodePBKDF2(digest, iterations, saltBytes, key), nil
+	}
+
+	return "", fmt.Errorf("unsupported keycloak password algorithm %s", algorithm)
+}
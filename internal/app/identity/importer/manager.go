@@ -0,0 +1,343 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/kamva/mgm/v3/field"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/invitation"
+	"github.com/superstackhq/identity/internal/app/identity/naming"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/user"
+	userapi "github.com/superstackhq/identity/pkg/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	MaxFileSize       = 10 << 20
+	maxLineLength     = 1 << 20
+	maxReportedErrors = 1000
+	progressInterval  = 50
+	rowTimeout        = 10 * time.Second
+	maxRunningJobs    = 4
+)
+
+var (
+	ErrJobRunning  = errors.New("an import is already running in the organization")
+	ErrTooManyJobs = errors.New("too many imports are running, try again later")
+)
+
+type Manager struct {
+	userManager       *user.Manager
+	invitationManager *invitation.Manager
+	hasher            *password.Hasher
+	slots             chan struct{}
+}
+
+func NewManager(userManager *user.Manager, invitationManager *invitation.Manager, hasher *password.Hasher) *Manager {
+	return &Manager{
+		userManager:       userManager,
+		invitationManager: invitationManager,
+		hasher:            hasher,
+		slots:             make(chan struct{}, maxRunningJobs),
+	}
+}
+
+// EnsureIndexes creates the indexes of import jobs, one of which lets only one
+// job run in an organization at a time.
+func (m *Manager) EnsureIndexes(ctx context.Context) error {
+	_, err := mgm.Coll(&Job{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "organization_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"status": StatusRunning}),
+		},
+	})
+
+	return err
+}
+
+// FailInterrupted marks the jobs that were still running when the server
+// stopped as failed.
+func (m *Manager) FailInterrupted(ctx context.Context) error {
+	_, err := mgm.Coll(&Job{}).UpdateMany(ctx, bson.M{
+		"status": StatusRunning,
+	}, bson.M{
+		"$set": bson.M{
+			"status":      StatusFailed,
+			"error":       "interrupted by a server restart",
+			"finished_at": time.Now().UTC(),
+		},
+	})
+
+	return err
+}
+
+// Start parses the file and imports its rows into the actor's organization
+// in the background. The returned job can be polled for progress. Only a few
+// jobs run at once on the server and only one per organization, others are
+// refused with ErrTooManyJobs and ErrJobRunning.
+func (m *Manager) Start(ctx context.Context, format Format, dryRun bool, adminRoles []string, data []byte, actor *authentication.AuthenticatedActor) (*Job, error) {
+	select {
+	case m.slots <- struct{}{}:
+	default:
+		return nil, ErrTooManyJobs
+	}
+
+	rows, invalid, err := parse(format, data, adminRoles)
+
+	if err != nil {
+		m.release()
+		return nil, err
+	}
+
+	job := &Job{
+		OrganizationID: actor.OrganizationID,
+		CreatorType:    actor.ActorType,
+		CreatorID:      actor.ActorID,
+		Format:         format,
+		DryRun:         dryRun,
+		AdminRoles:     adminRoles,
+		Status:         StatusRunning,
+		Total:          len(rows),
+		Errors:         []RowError{},
+	}
+
+	err = mgm.Coll(job).CreateWithCtx(ctx, job)
+
+	if err != nil {
+		m.release()
+
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrJobRunning
+		}
+
+		return nil, err
+	}
+
+	go m.run(job, rows, invalid, actor)
+
+	return job, nil
+}
+
+func (m *Manager) Get(ctx context.Context, jobID string, organizationID string) (*Job, error) {
+	id, err := primitive.ObjectIDFromHex(jobID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{}
+
+	err = mgm.Coll(job).FirstWithCtx(ctx, bson.M{
+		field.ID:          id,
+		"organization_id": organizationID,
+	}, job)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("import job not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (m *Manager) List(ctx context.Context, organizationID string, request *pagination.Request) (*pagination.Page, error) {
+	coll := mgm.Coll(&Job{})
+	filter := bson.M{
+		"organization_id": organizationID,
+	}
+
+	total, err := coll.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := []*Job{}
+
+	err = coll.SimpleFindWithCtx(ctx, &jobs, request.Filter(filter, "_id", true), request.Options("_id", true))
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &pagination.Page{Total: total, HasMore: request.More(len(jobs))}
+
+	if page.HasMore {
+		jobs = jobs[:request.Size]
+
+		page.NextCursor, err = pagination.Next(jobs[len(jobs)-1].ID, nil)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	page.Items = jobs
+
+	return page, nil
+}
+
+func (m *Manager) release() {
+	<-m.slots
+}
+
+func (m *Manager) run(job *Job, rows []*Row, invalid map[*Row]string, actor *authentication.AuthenticatedActor) {
+	defer m.release()
+
+	usernames := make(map[string]int)
+	emails := make(map[string]int)
+
+	for _, row := range rows {
+		message, ok := invalid[row]
+
+		if !ok {
+			message = m.importRow(job, row, usernames, emails, actor)
+		}
+
+		job.Processed++
+
+		if len(message) != 0 {
+			job.fail(row, message)
+		} else {
+			job.Imported++
+		}
+
+		if job.Processed%progressInterval == 0 {
+			m.save(job)
+		}
+	}
+
+	now := time.Now().UTC()
+	job.Status = StatusCompleted
+	job.FinishedAt = &now
+
+	m.save(job)
+}
+
+// importRow imports a single row and returns why it failed, if it did.
+func (m *Manager) importRow(job *Job, row *Row, usernames map[string]int, emails map[string]int, actor *authentication.AuthenticatedActor) string {
+	row.Email = strings.ToLower(strings.TrimSpace(row.Email))
+
+	if len(row.Username) == 0 {
+		row.Username = row.Email
+	}
+
+	if _, err := mail.ParseAddress(row.Email); err != nil {
+		return fmt.Sprintf("invalid email %s", row.Email)
+	}
+
+	usernameKey := naming.UsernameKey(row.Username)
+
+	if number, ok := usernames[usernameKey]; ok {
+		return fmt.Sprintf("username %s is already used in row %d", row.Username, number)
+	}
+
+	if number, ok := emails[row.Email]; ok {
+		return fmt.Sprintf("email %s is already used in row %d", row.Email, number)
+	}
+
+	usernames[usernameKey] = row.Number
+	emails[row.Email] = row.Number
+
+	if len(row.PasswordHash) != 0 {
+		if err := m.hasher.Check(row.PasswordHash); err != nil {
+			return err.Error()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rowTimeout)
+	defer cancel()
+
+	additionRequest := &userapi.AdditionRequest{
+		Username: row.Username,
+		Email:    row.Email,
+		Admin:    row.Admin,
+		Metadata: row.Metadata,
+	}
+
+	var err error
+
+	switch {
+	case job.DryRun:
+		err = m.userManager.CheckAddition(ctx, additionRequest, actor.OrganizationID)
+	case len(row.PasswordHash) != 0:
+		_, err = m.userManager.Import(ctx, &userapi.ImportRequest{
+			AdditionRequest: *additionRequest,
+			PasswordHash:    row.PasswordHash,
+			DisplayName:     row.DisplayName,
+			GivenName:       row.GivenName,
+			FamilyName:      row.FamilyName,
+			Locale:          row.Locale,
+			Timezone:        row.Timezone,
+			AvatarURL:       row.AvatarURL,
+		}, actor)
+
+		// Existing users decide themselves whether to join.
+		if errors.Is(err, user.ErrExistingIdentity) {
+			_, err = m.invitationManager.Invite(ctx, additionRequest, actor)
+		}
+	default:
+		_, err = m.invitationManager.Invite(ctx, additionRequest, actor)
+	}
+
+	if err != nil {
+		return err.Error()
+	}
+
+	return ""
+}
+
+func (m *Manager) save(job *Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), rowTimeout)
+	defer cancel()
+
+	err := mgm.Coll(job).UpdateWithCtx(ctx, job)
+
+	if err != nil {
+		zap.L().Error("error while saving import job progress", zap.String("job", job.ID.Hex()), zap.Error(err))
+	}
+}
+
+// Pseudonymise replaces references to the user in import jobs with the
+// pseudonym, including the rows reported for the user's email.
+func (m *Manager) Pseudonymise(ctx context.Context, userID string, email string, pseudonym string) error {
+	coll := mgm.Coll(&Job{})
+
+	_, err := coll.UpdateMany(ctx, bson.M{
+		"creator_id": userID,
+	}, bson.M{
+		"$set": bson.M{"creator_id": pseudonym},
+	})
+
+	if err != nil || len(email) == 0 {
+		return err
+	}
+
+	_, err = coll.UpdateMany(ctx, bson.M{
+		"errors.email": email,
+	}, bson.M{
+		"$set": bson.M{"errors.$[row].email": "", "errors.$[row].username": pseudonym},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: bson.A{bson.M{"row.email": email}},
+	}))
+
+	return err
+}
@@ -0,0 +1,88 @@
+package importer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/testdb"
+	"github.com/superstackhq/identity/pkg/actor"
+)
+
+var testActor = &authentication.AuthenticatedActor{
+	ActorType:      actor.TypeUser,
+	ActorID:        "admin",
+	OrganizationID: "org",
+	HasFullAccess:  true,
+}
+
+func TestStartRefusesJobsBeyondTheLimit(t *testing.T) {
+	m := NewManager(nil, nil, nil)
+
+	for i := 0; i < maxRunningJobs; i++ {
+		m.slots <- struct{}{}
+	}
+
+	if _, err := m.Start(context.Background(), FormatCSV, true, nil, []byte("username,email\n"), testActor); err != ErrTooManyJobs {
+		t.Errorf("Start returned %v, want ErrTooManyJobs", err)
+	}
+}
+
+func TestStartReleasesTheSlotOfRefusedFiles(t *testing.T) {
+	m := NewManager(nil, nil, nil)
+
+	for i := 0; i < maxRunningJobs+1; i++ {
+		if _, err := m.Start(context.Background(), Format("xml"), true, nil, nil, testActor); err == nil || err == ErrTooManyJobs {
+			t.Fatalf("Start returned %v, want a parse error", err)
+		}
+	}
+
+	if len(m.slots) != 0 {
+		t.Errorf("%d slots are still taken", len(m.slots))
+	}
+}
+
+func TestStartRefusesSecondJobInOrganization(t *testing.T) {
+	ctx := testdb.Setup(t)
+	m := NewManager(nil, nil, nil)
+
+	if err := m.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	running := &Job{OrganizationID: testActor.OrganizationID, Status: StatusRunning, Errors: []RowError{}}
+
+	if err := mgm.Coll(running).CreateWithCtx(ctx, running); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.Start(ctx, FormatCSV, true, nil, []byte("username,email\n"), testActor); err != ErrJobRunning {
+		t.Errorf("Start returned %v, want ErrJobRunning", err)
+	}
+
+	if len(m.slots) != 0 {
+		t.Errorf("%d slots are still taken", len(m.slots))
+	}
+
+	other := *testActor
+	other.OrganizationID = "other"
+
+	job, err := m.Start(ctx, FormatCSV, true, nil, []byte("username,email\n"), &other)
+
+	if err != nil {
+		t.Fatalf("job in another organization was refused: %v", err)
+	}
+
+	if job.OrganizationID != "other" {
+		t.Errorf("job is in %s, want other", job.OrganizationID)
+	}
+
+	// The job has no rows and only has to record that it completed.
+	for deadline := time.Now().Add(5 * time.Second); len(m.slots) != 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("job did not finish")
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parse reads the rows of the file. Rows that cannot be read are returned with
+// an error message instead.
+func parse(format Format, data []byte, adminRoles []string) ([]*Row, map[*Row]string, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(data)
+	case FormatJSONL:
+		return parseJSONL(data)
+	case FormatAuth0:
+		return parseAuth0(data, adminRoles)
+	case FormatKeycloak:
+		return parseKeycloak(data, adminRoles)
+	}
+
+	return nil, nil, fmt.Errorf("unsupported import format %s", format)
+}
+
+func parseCSV(data []byte) ([]*Row, map[*Row]string, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("missing csv header")
+	}
+
+	columns := make(map[string]int, len(header))
+
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["email"]; !ok {
+		return nil, nil, fmt.Errorf("csv header must contain an email column")
+	}
+
+	value := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+
+		return ""
+	}
+
+	var rows []*Row
+	invalid := make(map[*Row]string)
+
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		row := &Row{Number: number}
+		rows = append(rows, row)
+
+		if err != nil {
+			invalid[row] = err.Error()
+			continue
+		}
+
+		row.Username = value(record, "username")
+		row.Email = value(record, "email")
+		row.PasswordHash = value(record, "password_hash")
+
+		if admin := value(record, "admin"); len(admin) != 0 {
+			row.Admin, err = strconv.ParseBool(admin)
+
+			if err != nil {
+				invalid[row] = fmt.Sprintf("invalid admin value %s", admin)
+			}
+		}
+	}
+
+	return rows, invalid, nil
+}
+
+func parseJSONL(data []byte) ([]*Row, map[*Row]string, error) {
+	documents, err := splitJSON(data)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []*Row
+	invalid := make(map[*Row]string)
+
+	for i, document := range documents {
+		row := &Row{}
+		err := json.Unmarshal(document, row)
+		row.Number = i + 1
+		rows = append(rows, row)
+
+		if err != nil {
+			invalid[row] = err.Error()
+		}
+	}
+
+	return rows, invalid, nil
+}
+
+// splitJSON returns the documents of either a JSON array or JSON lines.
+func splitJSON(data []byte) ([]json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+
+	if bytes.HasPrefix(data, []byte("[")) {
+		var documents []json.RawMessage
+
+		if err := json.Unmarshal(data, &documents); err != nil {
+			return nil, err
+		}
+
+		return documents, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+
+	var documents []json.RawMessage
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+
+		if len(line) != 0 {
+			documents = append(documents, json.RawMessage(append([]byte(nil), line...)))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+func hasRole(roles []string, adminRoles []string) bool {
+	for _, role := range roles {
+		for _, adminRole := range adminRoles {
+			if strings.EqualFold(role, adminRole) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
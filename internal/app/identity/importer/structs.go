@@ -0,0 +1,85 @@
+package importer
+
+import (
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/pkg/actor"
+)
+
+type Format string
+
+const (
+	FormatCSV      Format = "csv"
+	FormatJSONL    Format = "jsonl"
+	FormatAuth0    Format = "auth0"
+	FormatKeycloak Format = "keycloak"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "RUNNING"
+	StatusCompleted Status = "COMPLETED"
+	StatusFailed    Status = "FAILED"
+)
+
+// Row is one user to import. Rows without a password hash, and rows of users
+// that already have an account, are invited by email instead. Imported emails
+// are never taken as verified.
+type Row struct {
+	Number       int                    `json:"-"`
+	Username     string                 `json:"username"`
+	Email        string                 `json:"email"`
+	Admin        bool                   `json:"admin"`
+	PasswordHash string                 `json:"password_hash"`
+	DisplayName  string                 `json:"display_name"`
+	GivenName    string                 `json:"given_name"`
+	FamilyName   string                 `json:"family_name"`
+	Locale       string                 `json:"locale"`
+	Timezone     string                 `json:"timezone"`
+	AvatarURL    string                 `json:"avatar_url"`
+	Metadata     map[string]interface{} `json:"metadata"`
+}
+
+type RowError struct {
+	Row      int    `json:"row" bson:"row"`
+	Username string `json:"username" bson:"username"`
+	Email    string `json:"email" bson:"email"`
+	Message  string `json:"message" bson:"message"`
+}
+
+type Job struct {
+	mgm.DefaultModel `bson:",inline"`
+	OrganizationID   string     `json:"organization_id" bson:"organization_id"`
+	CreatorType      actor.Type `json:"creator_type" bson:"creator_type"`
+	CreatorID        string     `json:"creator_id" bson:"creator_id"`
+	Format           Format     `json:"format" bson:"format"`
+	DryRun           bool       `json:"dry_run" bson:"dry_run"`
+	AdminRoles       []string   `json:"admin_roles,omitempty" bson:"admin_roles,omitempty"`
+	Status           Status     `json:"status" bson:"status"`
+	Total            int        `json:"total" bson:"total"`
+	Processed        int        `json:"processed" bson:"processed"`
+	Imported         int        `json:"imported" bson:"imported"`
+	Failed           int        `json:"failed" bson:"failed"`
+	Errors           []RowError `json:"errors" bson:"errors"`
+	Error            string     `json:"error,omitempty" bson:"error,omitempty"`
+	FinishedAt       *time.Time `json:"finished_at" bson:"finished_at"`
+}
+
+func (j *Job) CollectionName() string {
+	return "import_jobs"
+}
+
+func (j *Job) fail(row *Row, message string) {
+	j.Failed++
+
+	if len(j.Errors) < maxReportedErrors {
+		j.Errors = append(j.Errors, RowError{
+			Row:      row.Number,
+			Username: row.Username,
+			Email:    row.Email,
+			Message:  message,
+		})
+	}
+}
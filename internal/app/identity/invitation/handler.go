@@ -0,0 +1,223 @@
+package invitation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superstackhq/common/api"
+	"github.com/superstackhq/identity/internal/app/identity/attribute"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/pkg/invitation"
+	"github.com/superstackhq/identity/pkg/user"
+)
+
+type Handler struct {
+	router        *gin.Engine
+	authenticator *authentication.Authenticator
+	manager       *Manager
+}
+
+func NewHandler(router *gin.Engine, authenticator *authentication.Authenticator, manager *Manager) *Handler {
+	return &Handler{
+		router:        router,
+		authenticator: authenticator,
+		manager:       manager,
+	}
+}
+
+func (h *Handler) Register() {
+	h.router.POST("/api/v1/invitations", h.invite)
+	h.router.POST("/api/v1/users", h.add)
+	h.router.GET("/api/v1/invitations", h.list)
+	h.router.POST("/api/v1/invitations/:invitationID/resend", h.resend)
+	h.router.DELETE("/api/v1/invitations/:invitationID", h.revoke)
+	h.router.POST("/api/v1/invitations/accept", h.accept)
+}
+
+func (h *Handler) invite(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	var request user.AdditionRequest
+	err = c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	i, err := h.manager.Invite(ctx, &request, a)
+
+	var validationError *attribute.ValidationError
+
+	switch {
+	case errors.As(err, &validationError):
+		c.AbortWithStatusJSON(http.StatusBadRequest, &attribute.ValidationResponse{
+			Success:    false,
+			Message:    validationError.Error(),
+			Violations: validationError.Violations,
+		})
+	case err != nil:
+		api.Error(c, http.StatusInternalServerError, err)
+	default:
+		c.JSON(http.StatusCreated, i)
+	}
+}
+
+// add keeps the endpoint that created users before they were invited
+// working for older clients.
+func (h *Handler) add(c *gin.Context) {
+	c.Header("Deprecation", "true")
+	c.Header("Link", "</api/v1/invitations>; rel=\"successor-version\"")
+
+	h.invite(c)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 1*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	request, err := pagination.Parse(c)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.manager.List(ctx, a.OrganizationID, request)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	pagination.Respond(c, page)
+}
+
+func (h *Handler) resend(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	invitationID, ok := c.Params.Get("invitationID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "invitation id is required")
+		return
+	}
+
+	i, err := h.manager.Resend(ctx, invitationID, a.OrganizationID)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, i)
+}
+
+func (h *Handler) revoke(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	invitationID, ok := c.Params.Get("invitationID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "invitation id is required")
+		return
+	}
+
+	i, err := h.manager.Revoke(ctx, invitationID, a)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, i)
+}
+
+func (h *Handler) accept(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	var request invitation.AcceptanceRequest
+	err := c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	i, err := h.manager.Accept(ctx, &request)
+
+	var violationError *password.PolicyViolationError
+
+	switch {
+	case errors.As(err, &violationError):
+		c.AbortWithStatusJSON(http.StatusBadRequest, &password.PolicyViolationResponse{
+			Success:    false,
+			Message:    violationError.Error(),
+			Violations: violationError.Violations,
+		})
+	case errors.Is(err, token.ErrInvalid):
+		api.Error(c, http.StatusBadRequest, err)
+	case err != nil:
+		api.Error(c, http.StatusInternalServerError, err)
+	default:
+		c.JSON(http.StatusOK, i)
+	}
+}
@@ -0,0 +1,339 @@
+package invitation
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/kamva/mgm/v3/field"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/mail"
+	"github.com/superstackhq/identity/internal/app/identity/organization"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/internal/app/identity/user"
+	"github.com/superstackhq/identity/pkg/invitation"
+	userapi "github.com/superstackhq/identity/pkg/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+)
+
+type Manager struct {
+	userManager         *user.Manager
+	organizationManager *organization.Manager
+	tokenManager        *token.Manager
+	mailTransport       mail.Transport
+	config              *Config
+}
+
+func NewManager(userManager *user.Manager, organizationManager *organization.Manager, tokenManager *token.Manager, mailTransport mail.Transport, config *Config) *Manager {
+	return &Manager{
+		userManager:         userManager,
+		organizationManager: organizationManager,
+		tokenManager:        tokenManager,
+		mailTransport:       mailTransport,
+		config:              config,
+	}
+}
+
+func (m *Manager) Invite(ctx context.Context, additionRequest *userapi.AdditionRequest, actor *authentication.AuthenticatedActor) (*Invitation, error) {
+	if len(additionRequest.Username) == 0 {
+		additionRequest.Username = additionRequest.Email
+	}
+
+	u, err := m.userManager.Add(ctx, additionRequest, actor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Invitation{
+		Email:          u.Email,
+		Username:       u.Username,
+		Admin:          u.Admin,
+		UserID:         u.ID.Hex(),
+		OrganizationID: u.OrganizationID,
+		InviterType:    actor.ActorType,
+		InviterID:      actor.ActorID,
+		Status:         StatusPending,
+	}
+
+	err = mgm.Coll(i).CreateWithCtx(ctx, i)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The invitation stands even if the email cannot be sent, so that it can
+	// be resent instead of blocking another invitation of the user.
+	err = m.send(ctx, i)
+
+	if err != nil {
+		zap.L().Warn("error while sending invitation", zap.String("invitation", i.ID.Hex()), zap.Error(err))
+	}
+
+	return i, nil
+}
+
+func (m *Manager) List(ctx context.Context, organizationID string, request *pagination.Request) (*pagination.Page, error) {
+	coll := mgm.Coll(&Invitation{})
+	filter := bson.M{
+		"organization_id": organizationID,
+	}
+
+	total, err := coll.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	invitations := []*Invitation{}
+
+	err = coll.SimpleFindWithCtx(ctx, &invitations, request.Filter(filter, "_id", true), request.Options("_id", true))
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &pagination.Page{Total: total, HasMore: request.More(len(invitations))}
+
+	if page.HasMore {
+		invitations = invitations[:request.Size]
+
+		page.NextCursor, err = pagination.Next(invitations[len(invitations)-1].ID, nil)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, i := range invitations {
+		i.refreshStatus()
+	}
+
+	page.Items = invitations
+
+	return page, nil
+}
+
+func (m *Manager) Resend(ctx context.Context, invitationID string, organizationID string) (*Invitation, error) {
+	i, err := m.get(ctx, invitationID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if i.Status != StatusPending && i.Status != StatusExpired {
+		return nil, fmt.Errorf("invitation is %s", strings.ToLower(string(i.Status)))
+	}
+
+	i.Status = StatusPending
+
+	err = m.send(ctx, i)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (m *Manager) Revoke(ctx context.Context, invitationID string, actor *authentication.AuthenticatedActor) (*Invitation, error) {
+	i, err := m.get(ctx, invitationID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if i.Status != StatusPending && i.Status != StatusExpired {
+		return nil, fmt.Errorf("invitation is %s", strings.ToLower(string(i.Status)))
+	}
+
+	err = m.tokenManager.Invalidate(ctx, token.PurposeInvitation, i.UserID, i.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.userManager.Delete(ctx, i.UserID, actor)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i.Status = StatusRevoked
+
+	err = mgm.Coll(i).UpdateWithCtx(ctx, i)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (m *Manager) Accept(ctx context.Context, acceptanceRequest *invitation.AcceptanceRequest) (*Invitation, error) {
+	t, err := m.tokenManager.Find(ctx, token.PurposeInvitation, acceptanceRequest.Token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Invitation{}
+
+	err = mgm.Coll(i).FirstWithCtx(ctx, bson.M{
+		"user_id":         t.UserID,
+		"organization_id": t.OrganizationID,
+		"status":          StatusPending,
+	}, i)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, token.ErrInvalid
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.userManager.Activate(ctx, i.UserID, i.OrganizationID, acceptanceRequest.Password)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.tokenManager.Consume(ctx, token.PurposeInvitation, acceptanceRequest.Token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	i.Status = StatusAccepted
+	i.AcceptedAt = &now
+
+	err = mgm.Coll(i).UpdateWithCtx(ctx, i)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (m *Manager) get(ctx context.Context, invitationID string, organizationID string) (*Invitation, error) {
+	id, err := primitive.ObjectIDFromHex(invitationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := &Invitation{}
+
+	err = mgm.Coll(i).FirstWithCtx(ctx, bson.M{
+		field.ID:          id,
+		"organization_id": organizationID,
+	}, i)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("invitation not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	i.refreshStatus()
+
+	return i, nil
+}
+
+func (m *Manager) send(ctx context.Context, i *Invitation) error {
+	org, err := m.organizationManager.Get(ctx, i.OrganizationID)
+
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := m.tokenManager.Issue(ctx, token.PurposeInvitation, i.UserID, i.OrganizationID, m.config.Validity)
+
+	if err != nil {
+		return err
+	}
+
+	sendErr := m.mailTransport.Send(ctx, &mail.Message{
+		To:      i.Email,
+		Subject: fmt.Sprintf("You have been invited to %s", org.Name),
+		Body: fmt.Sprintf("You have been invited to join %s as %s.\n\n"+
+			"Use the link below to set your password. It expires in %s and can only be used once.\n\n%s\n",
+			org.Name, i.Username, m.config.Validity, m.link(plaintext)),
+	})
+
+	i.ExpiresAt = time.Now().UTC().Add(m.config.Validity)
+	i.SentCount++
+	i.DeliveryFailed = sendErr != nil
+
+	err = mgm.Coll(i).UpdateWithCtx(ctx, i)
+
+	if err != nil {
+		return err
+	}
+
+	return sendErr
+}
+
+func (m *Manager) link(plaintext string) string {
+	return fmt.Sprintf("%s/accept-invitation?token=%s", strings.TrimSuffix(m.config.WebURL, "/"), url.QueryEscape(plaintext))
+}
+
+// Pseudonymise strips the personal data of the user from invitations sent to
+// them and replaces references to them with the pseudonym.
+func (m *Manager) Pseudonymise(ctx context.Context, userID string, pseudonym string) error {
+	coll := mgm.Coll(&Invitation{})
+
+	_, err := coll.UpdateMany(ctx, bson.M{
+		"user_id": userID,
+	}, bson.M{
+		"$set": bson.M{"user_id": pseudonym, "email": "", "username": pseudonym},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = coll.UpdateMany(ctx, bson.M{
+		"inviter_id": userID,
+	}, bson.M{
+		"$set": bson.M{"inviter_id": pseudonym},
+	})
+
+	return err
+}
+
+// ListByUser returns the invitations of the user into the organization, or
+// into any organization if it is empty.
+func (m *Manager) ListByUser(ctx context.Context, userID string, organizationID string) ([]*Invitation, error) {
+	invitations := []*Invitation{}
+	filter := bson.M{"user_id": userID}
+
+	if len(organizationID) != 0 {
+		filter["organization_id"] = organizationID
+	}
+
+	err := mgm.Coll(&Invitation{}).SimpleFindWithCtx(ctx, &invitations, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, i := range invitations {
+		i.refreshStatus()
+	}
+
+	return invitations, nil
+}
@@ -0,0 +1,224 @@
+package invitation
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/breach"
+	"github.com/superstackhq/identity/internal/app/identity/mail"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
+	"github.com/superstackhq/identity/internal/app/identity/organization"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/session"
+	"github.com/superstackhq/identity/internal/app/identity/testdb"
+	"github.com/superstackhq/identity/internal/app/identity/throttle"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/internal/app/identity/user"
+	"github.com/superstackhq/identity/pkg/actor"
+	"github.com/superstackhq/identity/pkg/invitation"
+	userapi "github.com/superstackhq/identity/pkg/user"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var linkToken = regexp.MustCompile(`token=(\S+)`)
+
+// outbox keeps the messages sent instead of delivering them.
+type outbox struct {
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, message *mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, message)
+
+	return nil
+}
+
+// lastToken returns the token in the link of the last message sent.
+func (o *outbox) lastToken(t *testing.T) string {
+	t.Helper()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.messages) == 0 {
+		t.Fatal("no message was sent")
+	}
+
+	match := linkToken.FindStringSubmatch(o.messages[len(o.messages)-1].Body)
+
+	if match == nil {
+		t.Fatal("message has no link")
+	}
+
+	plaintext, err := url.QueryUnescape(match[1])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return plaintext
+}
+
+func newTestManager(t *testing.T) (context.Context, *Manager, *user.Manager, *outbox) {
+	ctx := testdb.Setup(t)
+
+	sessionManager := session.NewManager()
+	membershipManager := membership.NewManager()
+	organizationManager := organization.NewManager(membershipManager)
+	tokenManager := token.NewManager()
+	sent := &outbox{}
+	userManager := user.NewManager(organizationManager, membershipManager, authentication.NewAuthenticator("secret", sessionManager),
+		breach.NewNopChecker(), password.NewHasher(password.NewBcrypt(4)), tokenManager, throttle.NewManager(&throttle.Config{}),
+		sessionManager, sent, &user.Config{
+			WebURL:          "http://localhost",
+			SessionDuration: time.Hour,
+			Retention:       time.Hour,
+		})
+
+	for _, ensure := range []func(context.Context) error{
+		membershipManager.EnsureIndexes,
+		organizationManager.EnsureIndexes,
+		userManager.EnsureIndexes,
+	} {
+		if err := ensure(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return ctx, NewManager(userManager, organizationManager, tokenManager, sent, &Config{
+		WebURL:   "http://localhost",
+		Validity: time.Hour,
+	}), userManager, sent
+}
+
+func signUp(ctx context.Context, t *testing.T, userManager *user.Manager, username string, email string, organizationName string) *authentication.AuthenticatedActor {
+	t.Helper()
+
+	member, err := userManager.SignUp(ctx, &userapi.SignUpRequest{
+		Username:         username,
+		Email:            email,
+		Password:         "Correct-Horse-9-Battery",
+		OrganizationName: organizationName,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &authentication.AuthenticatedActor{
+		ActorType:      actor.TypeUser,
+		ActorID:        member.ID.Hex(),
+		OrganizationID: member.OrganizationID,
+		HasFullAccess:  true,
+	}
+}
+
+func TestInvitationsToSeveralOrganizationsAreIndependent(t *testing.T) {
+	ctx, m, userManager, sent := newTestManager(t)
+
+	invitee := signUp(ctx, t, userManager, "bob", "bob@example.com", "Bobs")
+	first := signUp(ctx, t, userManager, "alice", "", "Acme")
+	second := signUp(ctx, t, userManager, "carol", "", "Contoso")
+
+	// Invitations reach the same identity only once its email is verified.
+	id, err := primitive.ObjectIDFromHex(invitee.ActorID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = mgm.Coll(&user.User{}).UpdateByID(ctx, id, bson.M{"$set": bson.M{"email_verified": true}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstInvitation, err := m.Invite(ctx, &userapi.AdditionRequest{Email: "bob@example.com"}, first)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstToken := sent.lastToken(t)
+
+	secondInvitation, err := m.Invite(ctx, &userapi.AdditionRequest{Email: "bob@example.com"}, second)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secondToken := sent.lastToken(t)
+
+	if firstInvitation.UserID != invitee.ActorID || secondInvitation.UserID != invitee.ActorID {
+		t.Fatalf("invitations went to %s and %s, want %s", firstInvitation.UserID, secondInvitation.UserID, invitee.ActorID)
+	}
+
+	for _, plaintext := range []string{firstToken, secondToken} {
+		if _, err = m.tokenManager.Find(ctx, token.PurposeInvitation, plaintext); err != nil {
+			t.Fatalf("inviting to another organization invalidated a token: %v", err)
+		}
+	}
+
+	if _, err = m.Revoke(ctx, firstInvitation.ID.Hex(), first); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.tokenManager.Find(ctx, token.PurposeInvitation, firstToken); err != token.ErrInvalid {
+		t.Errorf("token of the revoked invitation returned %v, want ErrInvalid", err)
+	}
+
+	if _, err = m.tokenManager.Find(ctx, token.PurposeInvitation, secondToken); err != nil {
+		t.Errorf("revoking an invitation invalidated the one of another organization: %v", err)
+	}
+}
+
+func TestInvitationTokenIsSingleUse(t *testing.T) {
+	ctx, m, userManager, sent := newTestManager(t)
+	owner := signUp(ctx, t, userManager, "alice", "", "Acme")
+
+	i, err := m.Invite(ctx, &userapi.AdditionRequest{Username: "bob", Email: "bob@example.com"}, owner)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := sent.lastToken(t)
+
+	if _, err = m.Resend(ctx, i.ID.Hex(), owner.OrganizationID); err != nil {
+		t.Fatal(err)
+	}
+
+	second := sent.lastToken(t)
+	acceptance := &invitation.AcceptanceRequest{Token: first, Password: "Correct-Horse-9-Battery"}
+
+	if _, err = m.Accept(ctx, acceptance); err != token.ErrInvalid {
+		t.Errorf("token replaced by a resend returned %v, want ErrInvalid", err)
+	}
+
+	acceptance.Token = second
+
+	accepted, err := m.Accept(ctx, acceptance)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accepted.Status != StatusAccepted {
+		t.Errorf("invitation is %s, want %s", accepted.Status, StatusAccepted)
+	}
+
+	if _, err = m.Accept(ctx, acceptance); err != token.ErrInvalid {
+		t.Errorf("second acceptance returned %v, want ErrInvalid", err)
+	}
+}
@@ -0,0 +1,44 @@
+package invitation
+
+import (
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/pkg/actor"
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "PENDING"
+	StatusAccepted Status = "ACCEPTED"
+	StatusRevoked  Status = "REVOKED"
+	StatusExpired  Status = "EXPIRED"
+)
+
+type Config struct {
+	WebURL   string
+	Validity time.Duration
+}
+
+type Invitation struct {
+	mgm.DefaultModel `bson:",inline"`
+	Email            string     `json:"email" bson:"email"`
+	Username         string     `json:"username" bson:"username"`
+	Admin            bool       `json:"admin" bson:"admin"`
+	UserID           string     `json:"user_id" bson:"user_id"`
+	OrganizationID   string     `json:"organization_id" bson:"organization_id"`
+	InviterType      actor.Type `json:"inviter_type" bson:"inviter_type"`
+	InviterID        string     `json:"inviter_id" bson:"inviter_id"`
+	Status           Status     `json:"status" bson:"status"`
+	SentCount        int        `json:"sent_count" bson:"sent_count"`
+	DeliveryFailed   bool       `json:"delivery_failed" bson:"delivery_failed"`
+	ExpiresAt        time.Time  `json:"expires_at" bson:"expires_at"`
+	AcceptedAt       *time.Time `json:"accepted_at" bson:"accepted_at"`
+}
+
+func (i *Invitation) refreshStatus() {
+	if i.Status == StatusPending && time.Now().After(i.ExpiresAt) {
+		i.Status = StatusExpired
+	}
+}
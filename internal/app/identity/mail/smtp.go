@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+type SMTPTransport struct {
+	config *SMTPConfig
+}
+
+func NewSMTPTransport(config *SMTPConfig) *SMTPTransport {
+	return &SMTPTransport{
+		config: config,
+	}
+}
+
+func (t *SMTPTransport) Send(ctx context.Context, message *Message) error {
+	var auth smtp.Auth
+
+	if len(t.config.Username) != 0 {
+		auth = smtp.PlainAuth("", t.config.Username, t.config.Password, t.config.Host)
+	}
+
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- smtp.SendMail(net.JoinHostPort(t.config.Host, t.config.Port), auth, t.config.From, []string{message.To}, t.compose(message))
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *SMTPTransport) compose(message *Message) []byte {
+	var builder strings.Builder
+
+	builder.WriteString(fmt.Sprintf("From: %s\r\n", t.config.From))
+	builder.WriteString(fmt.Sprintf("To: %s\r\n", message.To))
+	builder.WriteString(fmt.Sprintf("Subject: %s\r\n", message.Subject))
+	builder.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(message.Body, "\n", "\r\n"))
+
+	return []byte(builder.String())
+}
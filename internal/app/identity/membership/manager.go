@@ -0,0 +1,580 @@
+package membership
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/kamva/mgm/v3/field"
+	"github.com/superstackhq/identity/internal/app/identity/naming"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var sortFields = map[string]bool{
+	"username":   true,
+	"email":      true,
+	"admin":      true,
+	"creator_id": true,
+	"status":     true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// usernameIndex keeps usernames unique per organization by their key, which
+// makes them case insensitive and immune to look-alike characters.
+const usernameIndex = "organization_id_1_username_key_1"
+
+type Manager struct {
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+func (m *Manager) EnsureIndexes(ctx context.Context) error {
+	_, err := mgm.Coll(&Membership{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "organization_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"deleted": false}),
+		},
+		{
+			Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "deleted", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "deleted", Value: 1}, {Key: "updated_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "deleted", Value: 1}, {Key: "username", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "deleted", Value: 1}, {Key: "email", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "deleted", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "deleted", Value: 1}, {Key: "admin", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "creator_id", Value: 1}, {Key: "created_at", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "metadata.$**", Value: 1}},
+		},
+	})
+
+	return err
+}
+
+// EnsureUsernameIndex creates the unique username index. It has to wait for
+// existing duplicates to be renamed.
+func (m *Manager) EnsureUsernameIndex(ctx context.Context) error {
+	_, err := mgm.Coll(&Membership{}).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "username_key", Value: 1}},
+		Options: options.Index().
+			SetName(usernameIndex).
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"deleted": false}),
+	})
+
+	return err
+}
+
+func (m *Manager) Create(ctx context.Context, membership *Membership) error {
+	membership.UsernameKey = naming.UsernameKey(membership.Username)
+	return mgm.Coll(membership).CreateWithCtx(ctx, membership)
+}
+
+func (m *Manager) Update(ctx context.Context, membership *Membership) error {
+	membership.UsernameKey = naming.UsernameKey(membership.Username)
+	return mgm.Coll(membership).UpdateWithCtx(ctx, membership)
+}
+
+func (m *Manager) Get(ctx context.Context, userID string, organizationID string) (*Membership, error) {
+	membership := &Membership{}
+
+	err := mgm.Coll(membership).FirstWithCtx(ctx, bson.M{
+		"user_id":         userID,
+		"organization_id": organizationID,
+		"deleted":         false,
+	}, membership)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+// GetDeleted returns the most recently deleted membership of the user in the
+// organization.
+func (m *Manager) GetDeleted(ctx context.Context, userID string, organizationID string) (*Membership, error) {
+	membership := &Membership{}
+
+	err := mgm.Coll(membership).FirstWithCtx(ctx, bson.M{
+		"user_id":         userID,
+		"organization_id": organizationID,
+		"deleted":         true,
+	}, membership, options.FindOne().SetSort(bson.D{{Key: "deleted_at", Value: -1}}))
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("deleted user not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+func (m *Manager) ListByUser(ctx context.Context, userID string) ([]*Membership, error) {
+	memberships := []*Membership{}
+
+	err := mgm.Coll(&Membership{}).SimpleFindWithCtx(ctx, &memberships, bson.M{
+		"user_id": userID,
+		"deleted": false,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// PageByUser returns one page of the memberships of the user, oldest first.
+func (m *Manager) PageByUser(ctx context.Context, userID string, request *pagination.Request) ([]*Membership, *pagination.Page, error) {
+	coll := mgm.Coll(&Membership{})
+	filter := bson.M{
+		"user_id": userID,
+		"deleted": false,
+	}
+
+	total, err := coll.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	memberships := []*Membership{}
+
+	err = coll.SimpleFindWithCtx(ctx, &memberships, request.Filter(filter, "_id", false), request.Options("_id", false))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &pagination.Page{Total: total, HasMore: request.More(len(memberships))}
+
+	if page.HasMore {
+		memberships = memberships[:request.Size]
+
+		page.NextCursor, err = pagination.Next(memberships[len(memberships)-1].ID, nil)
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return memberships, page, nil
+}
+
+// Search returns one page of the memberships of the organization matching
+// the query. The page carries everything but the items, which callers fill in
+// with their own view of the memberships.
+func (m *Manager) Search(ctx context.Context, organizationID string, query *Query, request *pagination.Request) ([]*Membership, *pagination.Page, error) {
+	if len(query.Sort) != 0 && !sortFields[query.Sort] {
+		return nil, nil, fmt.Errorf("cannot sort by %s", query.Sort)
+	}
+
+	coll := mgm.Coll(&Membership{})
+	filter := query.filter(organizationID)
+	field := query.sortField()
+
+	if err := request.Check(field, (&Membership{}).sortValue(field)); err != nil {
+		return nil, nil, err
+	}
+
+	total, err := coll.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	memberships := []*Membership{}
+
+	err = coll.SimpleFindWithCtx(ctx, &memberships, request.Filter(filter, field, query.Descending), request.Options(field, query.Descending))
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page := &pagination.Page{Total: total, HasMore: request.More(len(memberships))}
+
+	if page.HasMore {
+		memberships = memberships[:request.Size]
+		last := memberships[len(memberships)-1]
+
+		page.NextCursor, err = pagination.Next(last.ID, last.sortValue(field))
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return memberships, page, nil
+}
+
+// Each walks the memberships of the organization matching the query in
+// batches, reading them from a cursor so that the whole result never has to
+// be held in memory.
+func (m *Manager) Each(ctx context.Context, organizationID string, query *Query, batchSize int, fn func([]*Membership) error) error {
+	if len(query.Sort) != 0 && !sortFields[query.Sort] {
+		return fmt.Errorf("cannot sort by %s", query.Sort)
+	}
+
+	direction := 1
+
+	if query.Descending {
+		direction = -1
+	}
+
+	sort := bson.D{{Key: "_id", Value: direction}}
+
+	if field := query.sortField(); field != "_id" {
+		sort = append(bson.D{{Key: field, Value: direction}}, sort...)
+	}
+
+	cursor, err := mgm.Coll(&Membership{}).Find(ctx, query.filter(organizationID), options.Find().SetSort(sort).SetBatchSize(int32(batchSize)))
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+
+	batch := make([]*Membership, 0, batchSize)
+
+	for cursor.Next(ctx) {
+		ms := &Membership{}
+
+		if err := cursor.Decode(ms); err != nil {
+			return err
+		}
+
+		batch = append(batch, ms)
+
+		if len(batch) == batchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+
+			batch = make([]*Membership, 0, batchSize)
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	if len(batch) != 0 {
+		return fn(batch)
+	}
+
+	return nil
+}
+
+// ListUsersWithoutIdentity returns the users whose memberships have no
+// username copied onto them yet.
+func (m *Manager) ListUsersWithoutIdentity(ctx context.Context) ([]string, error) {
+	values, err := mgm.Coll(&Membership{}).Distinct(ctx, "user_id", bson.M{
+		"username": bson.M{"$exists": false},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if userID, ok := value.(string); ok {
+			userIDs = append(userIDs, userID)
+		}
+	}
+
+	return userIDs, nil
+}
+
+// SyncIdentity copies the username and email of the user onto their
+// memberships.
+func (m *Manager) SyncIdentity(ctx context.Context, userID string, username string, email string) error {
+	_, err := mgm.Coll(&Membership{}).UpdateMany(ctx, bson.M{
+		"user_id": userID,
+	}, bson.M{
+		"$set": bson.M{
+			"username":     username,
+			"username_key": naming.UsernameKey(username),
+			"email":        email,
+			"updated_at":   time.Now().UTC(),
+		},
+	})
+
+	return err
+}
+
+// GetByUsername returns the membership in the organization whose username
+// has the same key as the given one, or nil if there is none.
+func (m *Manager) GetByUsername(ctx context.Context, organizationID string, username string) (*Membership, error) {
+	membership := &Membership{}
+
+	err := mgm.Coll(membership).FirstWithCtx(ctx, bson.M{
+		"organization_id": organizationID,
+		"username_key":    naming.UsernameKey(username),
+		"deleted":         false,
+	}, membership)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+// BackfillUsernameKeys sets the username key of memberships stored before
+// usernames were normalized.
+func (m *Manager) BackfillUsernameKeys(ctx context.Context) error {
+	coll := mgm.Coll(&Membership{})
+
+	cursor, err := coll.Find(ctx, bson.M{
+		"username":     bson.M{"$exists": true},
+		"username_key": bson.M{"$exists": false},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		ms := &Membership{}
+
+		if err := cursor.Decode(ms); err != nil {
+			return err
+		}
+
+		_, err = coll.UpdateByID(ctx, ms.ID, bson.M{
+			"$set": bson.M{"username_key": naming.UsernameKey(ms.Username)},
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// ListDuplicateUsernames returns the groups of memberships that share a
+// username key within an organization, oldest first in each group.
+func (m *Manager) ListDuplicateUsernames(ctx context.Context) ([][]*Membership, error) {
+	coll := mgm.Coll(&Membership{})
+
+	cursor, err := coll.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"deleted": false}},
+		bson.M{"$group": bson.M{
+			field.ID: bson.M{"organization_id": "$organization_id", "username_key": "$username_key"},
+			"ids":    bson.M{"$push": "$_id"},
+			"count":  bson.M{"$sum": 1},
+		}},
+		bson.M{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
+	}
+
+	err = cursor.All(ctx, &groups)
+
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates := make([][]*Membership, 0, len(groups))
+
+	for _, group := range groups {
+		memberships := []*Membership{}
+
+		err = coll.SimpleFindWithCtx(ctx, &memberships, bson.M{
+			field.ID: bson.M{"$in": group.IDs},
+		}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+
+		if err != nil {
+			return nil, err
+		}
+
+		duplicates = append(duplicates, memberships)
+	}
+
+	return duplicates, nil
+}
+
+// ListByOrganization returns every membership of the organization that is
+// not deleted.
+func (m *Manager) ListByOrganization(ctx context.Context, organizationID string) ([]*Membership, error) {
+	memberships := []*Membership{}
+
+	err := mgm.Coll(&Membership{}).SimpleFindWithCtx(ctx, &memberships, bson.M{
+		"organization_id": organizationID,
+		"deleted":         false,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// ListDeletedWithOrganization returns the memberships that were deleted
+// together with the organization.
+func (m *Manager) ListDeletedWithOrganization(ctx context.Context, organizationID string) ([]*Membership, error) {
+	memberships := []*Membership{}
+
+	err := mgm.Coll(&Membership{}).SimpleFindWithCtx(ctx, &memberships, bson.M{
+		"organization_id":           organizationID,
+		"deleted_with_organization": true,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+// CountAdmins counts the active admins of the organization.
+func (m *Manager) CountAdmins(ctx context.Context, organizationID string) (int64, error) {
+	return mgm.Coll(&Membership{}).CountDocuments(ctx, bson.M{
+		"organization_id": organizationID,
+		"admin":           true,
+		"status":          StatusActive,
+		"deleted":         false,
+	})
+}
+
+// OldestAdmin returns the active admin that joined the organization first, or
+// nil if it has none.
+func (m *Manager) OldestAdmin(ctx context.Context, organizationID string) (*Membership, error) {
+	membership := &Membership{}
+
+	err := mgm.Coll(membership).FirstWithCtx(ctx, bson.M{
+		"organization_id": organizationID,
+		"admin":           true,
+		"status":          StatusActive,
+		"deleted":         false,
+	}, membership, options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return membership, nil
+}
+
+func (m *Manager) Exists(ctx context.Context, userID string, organizationID string) (bool, error) {
+	count, err := mgm.Coll(&Membership{}).CountDocuments(ctx, bson.M{
+		"user_id":         userID,
+		"organization_id": organizationID,
+		"deleted":         false,
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
+func (m *Manager) Count(ctx context.Context, userID string) (int64, error) {
+	return mgm.Coll(&Membership{}).CountDocuments(ctx, bson.M{
+		"user_id": userID,
+		"deleted": false,
+	})
+}
+
+// Erase deletes the memberships of the user and replaces the references they
+// left on other memberships with the pseudonym.
+func (m *Manager) Erase(ctx context.Context, userID string, pseudonym string) error {
+	coll := mgm.Coll(&Membership{})
+
+	_, err := coll.DeleteMany(ctx, bson.M{
+		"user_id": userID,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = coll.UpdateMany(ctx, bson.M{
+		"creator_id": userID,
+	}, bson.M{
+		"$set": bson.M{"creator_id": pseudonym},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = coll.UpdateMany(ctx, bson.M{
+		"status_history.actor_id": userID,
+	}, bson.M{
+		"$set": bson.M{"status_history.$[change].actor_id": pseudonym},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"change.actor_id": userID}},
+	}))
+
+	return err
+}
+
+// ListAllByUser returns the memberships of the user including deleted ones,
+// in the organization or in every organization if it is empty.
+func (m *Manager) ListAllByUser(ctx context.Context, userID string, organizationID string) ([]*Membership, error) {
+	memberships := []*Membership{}
+	filter := bson.M{"user_id": userID}
+
+	if len(organizationID) != 0 {
+		filter["organization_id"] = organizationID
+	}
+
+	err := mgm.Coll(&Membership{}).SimpleFindWithCtx(ctx, &memberships, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return memberships, nil
+}
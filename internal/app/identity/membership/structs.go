@@ -0,0 +1,204 @@
+package membership
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/pkg/actor"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Status string
+
+const (
+	StatusInvited   Status = "INVITED"
+	StatusActive    Status = "ACTIVE"
+	StatusSuspended Status = "SUSPENDED"
+	StatusDeleted   Status = "DELETED"
+)
+
+type StatusChange struct {
+	Status    Status     `json:"status" bson:"status"`
+	ActorType actor.Type `json:"actor_type" bson:"actor_type"`
+	ActorID   string     `json:"actor_id" bson:"actor_id"`
+	Reason    string     `json:"reason" bson:"reason"`
+	ChangedAt time.Time  `json:"changed_at" bson:"changed_at"`
+}
+
+type Membership struct {
+	mgm.DefaultModel `bson:",inline"`
+	UserID           string         `json:"user_id" bson:"user_id"`
+	OrganizationID   string         `json:"organization_id" bson:"organization_id"`
+	Username         string         `json:"username" bson:"username"`
+	UsernameKey      string         `json:"-" bson:"username_key"`
+	Email            string         `json:"email" bson:"email"`
+	Admin            bool           `json:"admin" bson:"admin"`
+	Status           Status         `json:"status" bson:"status"`
+	StatusHistory    []StatusChange `json:"status_history" bson:"status_history"`
+	CreatorType      actor.Type     `json:"creator_type" bson:"creator_type"`
+	CreatorID        string         `json:"creator_id" bson:"creator_id"`
+	Metadata         bson.M         `json:"metadata" bson:"metadata,omitempty"`
+	Deleted          bool           `json:"deleted" bson:"deleted"`
+	DeletedAt        *time.Time     `json:"deleted_at" bson:"deleted_at"`
+
+	// DeletedWithOrganization marks memberships deleted because their
+	// organization was, so that restoring it brings back only those.
+	DeletedWithOrganization bool `json:"-" bson:"deleted_with_organization,omitempty"`
+}
+
+// Query filters and sorts the memberships of an organization. Username and
+// email are copied onto memberships so that the whole query runs against one
+// collection.
+type Query struct {
+	Search         string
+	UsernamePrefix string
+	EmailPrefix    string
+	Admin          *bool
+	CreatorID      string
+	Statuses       []Status
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	UpdatedAfter   time.Time
+	UpdatedBefore  time.Time
+	Metadata       map[string]interface{}
+	Sort           string
+	Descending     bool
+}
+
+// SetStatus moves the membership to the given status and records the change.
+func (m *Membership) SetStatus(status Status, actorType actor.Type, actorID string, reason string) {
+	now := time.Now().UTC()
+
+	m.Status = status
+	m.StatusHistory = append(m.StatusHistory, StatusChange{
+		Status:    status,
+		ActorType: actorType,
+		ActorID:   actorID,
+		Reason:    reason,
+		ChangedAt: now,
+	})
+
+	if status == StatusDeleted {
+		m.Deleted = true
+		m.DeletedAt = &now
+	} else {
+		m.Deleted = false
+		m.DeletedAt = nil
+	}
+}
+
+// PreviousStatus returns the status the membership had before its current
+// one, or active if the history does not go back that far.
+func (m *Membership) PreviousStatus() Status {
+	if len(m.StatusHistory) < 2 {
+		return StatusActive
+	}
+
+	return m.StatusHistory[len(m.StatusHistory)-2].Status
+}
+
+func (q *Query) filter(organizationID string) bson.M {
+	filter := bson.M{
+		"organization_id": organizationID,
+		"deleted":         false,
+	}
+
+	if len(q.Statuses) != 0 {
+		filter["status"] = bson.M{"$in": q.Statuses}
+
+		for _, status := range q.Statuses {
+			if status == StatusDeleted {
+				delete(filter, "deleted")
+			}
+		}
+	}
+
+	if len(q.UsernamePrefix) != 0 {
+		filter["username"] = bson.M{"$regex": "^" + regexp.QuoteMeta(q.UsernamePrefix)}
+	}
+
+	if len(q.EmailPrefix) != 0 {
+		filter["email"] = bson.M{"$regex": "^" + regexp.QuoteMeta(strings.ToLower(q.EmailPrefix))}
+	}
+
+	if len(q.Search) != 0 {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q.Search), Options: "i"}
+
+		filter["$or"] = bson.A{
+			bson.M{"username": pattern},
+			bson.M{"email": pattern},
+		}
+	}
+
+	if q.Admin != nil {
+		filter["admin"] = *q.Admin
+	}
+
+	if len(q.CreatorID) != 0 {
+		filter["creator_id"] = q.CreatorID
+	}
+
+	for key, value := range q.Metadata {
+		filter["metadata."+key] = value
+	}
+
+	if created := dateRange(q.CreatedAfter, q.CreatedBefore); created != nil {
+		filter["created_at"] = created
+	}
+
+	if updated := dateRange(q.UpdatedAfter, q.UpdatedBefore); updated != nil {
+		filter["updated_at"] = updated
+	}
+
+	return filter
+}
+
+func (q *Query) sortField() string {
+	if len(q.Sort) == 0 {
+		return "_id"
+	}
+
+	return q.Sort
+}
+
+func (m *Membership) sortValue(field string) interface{} {
+	switch field {
+	case "username":
+		return m.Username
+	case "email":
+		return m.Email
+	case "admin":
+		return m.Admin
+	case "creator_id":
+		return m.CreatorID
+	case "status":
+		return m.Status
+	case "created_at":
+		return m.CreatedAt
+	case "updated_at":
+		return m.UpdatedAt
+	}
+
+	return nil
+}
+
+func dateRange(after time.Time, before time.Time) bson.M {
+	if after.IsZero() && before.IsZero() {
+		return nil
+	}
+
+	r := bson.M{}
+
+	if !after.IsZero() {
+		r["$gte"] = after
+	}
+
+	if !before.IsZero() {
+		r["$lt"] = before
+	}
+
+	return r
+}
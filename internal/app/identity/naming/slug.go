@@ -0,0 +1,67 @@
+package naming
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	maxSlugLength = 63
+	fallbackSlug  = "org"
+)
+
+// Slug turns a name into lowercase ASCII letters and digits separated by
+// single hyphens, so that it can be used in URLs. Accents are stripped and
+// any other character separates words.
+func Slug(name string) string {
+	decomposed := norm.NFKD.String(cases.Fold().String(name))
+
+	var b strings.Builder
+	separate := false
+
+	for _, r := range decomposed {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if separate && b.Len() != 0 {
+				b.WriteByte('-')
+			}
+
+			b.WriteRune(r)
+			separate = false
+		default:
+			separate = true
+		}
+	}
+
+	slug := b.String()
+
+	if len(slug) > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength], "-")
+	}
+
+	if len(slug) == 0 {
+		return fallbackSlug
+	}
+
+	return slug
+}
+
+// SlugWithSuffix appends the suffix to the slug, shortening the slug so that
+// the result still fits.
+func SlugWithSuffix(slug string, suffix string) string {
+	if len(slug)+len(suffix)+1 > maxSlugLength {
+		slug = strings.TrimRight(slug[:maxSlugLength-len(suffix)-1], "-")
+	}
+
+	return slug + "-" + suffix
+}
+
+// NameKey returns the form two names share when they differ only in case or
+// Unicode representation.
+func NameKey(name string) string {
+	return norm.NFC.String(cases.Fold().String(norm.NFKC.String(strings.TrimSpace(name))))
+}
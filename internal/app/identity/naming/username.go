@@ -0,0 +1,76 @@
+package naming
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const maxUsernameLength = 128
+
+// confusables maps characters that render like a lowercase Latin letter or
+// digit onto it, following the Unicode confusables data for the scripts users
+// most often mix into Latin names. Keys are already case folded.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ј': 'j', 'ԁ': 'd',
+	'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l', 'һ': 'h',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ζ': 'z', 'η': 'n', 'ι': 'i', 'κ': 'k', 'μ': 'm',
+	'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ϲ': 'c', 'ϳ': 'j',
+	// Latin and digits
+	'ɡ': 'g', 'ı': 'i', '1': 'l', '|': 'l', '0': 'o',
+}
+
+// NormalizeUsername returns the NFKC form of the username and rejects
+// characters that do not belong in one. The case is kept for display.
+func NormalizeUsername(username string) (string, error) {
+	username = strings.TrimSpace(norm.NFKC.String(username))
+
+	if len(username) == 0 {
+		return "", fmt.Errorf("username is required")
+	}
+
+	if utf8.RuneCountInString(username) > maxUsernameLength {
+		return "", fmt.Errorf("username must be at most %d characters long", maxUsernameLength)
+	}
+
+	for _, r := range username {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsMark(r):
+		case strings.ContainsRune("._-@+", r):
+		default:
+			return "", fmt.Errorf("username must not contain %q", r)
+		}
+	}
+
+	return username, nil
+}
+
+// UsernameKey returns the skeleton two usernames share when people would
+// mistake one for the other: the NFKC form with the case folded, accents
+// stripped and confusable characters replaced. Usernames are unique by key.
+func UsernameKey(username string) string {
+	key := norm.NFD.String(cases.Fold().String(norm.NFKC.String(strings.TrimSpace(username))))
+
+	var b strings.Builder
+
+	for _, r := range key {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		if prototype, ok := confusables[r]; ok {
+			r = prototype
+		}
+
+		b.WriteRune(r)
+	}
+
+	return norm.NFC.String(b.String())
+}
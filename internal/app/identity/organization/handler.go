@@ -2,30 +2,45 @@ package organization
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/superstackhq/common/api"
 	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/pkg/actor"
+	"github.com/superstackhq/identity/pkg/organization"
 )
 
 type Handler struct {
 	router        *gin.Engine
 	authenticator *authentication.Authenticator
 	manager       *Manager
+	lifecycle     Lifecycle
 }
 
-func NewHandler(router *gin.Engine, authenticator *authentication.Authenticator, manager *Manager) *Handler {
+func NewHandler(router *gin.Engine, authenticator *authentication.Authenticator, manager *Manager, lifecycle Lifecycle) *Handler {
 	return &Handler{
 		router:        router,
 		authenticator: authenticator,
 		manager:       manager,
+		lifecycle:     lifecycle,
 	}
 }
 
 func (h *Handler) Register() {
 	h.router.GET("/api/v1/organization", h.get)
+	h.router.GET("/api/v1/organizations/:slug", h.getProfile)
+	h.router.PATCH("/api/v1/organization", h.update)
+	h.router.DELETE("/api/v1/organization", h.delete)
+	h.router.POST("/api/v1/organization/restore", h.restore)
+	h.router.POST("/api/v1/organization/ownership/transfer", h.requestOwnershipTransfer)
+	h.router.POST("/api/v1/organization/ownership/transfer/accept", h.acceptOwnershipTransfer)
+	h.router.DELETE("/api/v1/organization/ownership/transfer", h.cancelOwnershipTransfer)
+	h.router.PUT("/api/v1/organization/password-policy", h.updatePasswordPolicy)
+	h.router.PUT("/api/v1/organization/attributes", h.updateAttributeSchema)
 }
 
 func (h *Handler) get(c *gin.Context) {
@@ -48,3 +63,262 @@ func (h *Handler) get(c *gin.Context) {
 
 	c.JSON(http.StatusOK, org)
 }
+
+// getProfile returns what a sign in page needs to show for the organization
+// the slug in its URL belongs to.
+func (h *Handler) getProfile(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 1*time.Second)
+	defer cancel()
+
+	org, err := h.manager.GetBySlug(ctx, c.Param("slug"))
+
+	if err != nil {
+		api.Error(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, &organization.Profile{
+		Slug:        org.Slug,
+		Name:        org.Name,
+		DisplayName: org.DisplayName,
+		LogoURL:     org.LogoURL,
+	})
+}
+
+func (h *Handler) update(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	au, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !au.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	var request organization.UpdateRequest
+	err = c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	org, err := h.manager.Update(ctx, au.OrganizationID, &request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *Handler) delete(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 60*time.Second)
+	defer cancel()
+
+	au, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !au.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	response, err := h.lifecycle.DeleteOrganization(ctx, au)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) restore(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 60*time.Second)
+	defer cancel()
+
+	var request organization.RestoreRequest
+	err := c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	org, err := h.lifecycle.RestoreOrganization(ctx, &request)
+
+	switch {
+	case errors.Is(err, token.ErrInvalid):
+		api.Error(c, http.StatusBadRequest, err)
+	case err != nil:
+		api.Error(c, http.StatusInternalServerError, err)
+	default:
+		c.JSON(http.StatusOK, org)
+	}
+}
+
+func (h *Handler) requestOwnershipTransfer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	au, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !au.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	var request organization.OwnershipTransferRequest
+	err = c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	org, err := h.manager.RequestOwnershipTransfer(ctx, &request, au)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *Handler) acceptOwnershipTransfer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	au, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if au.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	org, err := h.manager.AcceptOwnershipTransfer(ctx, au)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *Handler) cancelOwnershipTransfer(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	au, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if au.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	org, err := h.manager.CancelOwnershipTransfer(ctx, au)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *Handler) updatePasswordPolicy(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	au, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !au.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	var request organization.PasswordPolicyUpdateRequest
+	err = c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	org, err := h.manager.UpdatePasswordPolicy(ctx, au.OrganizationID, &request)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
+
+func (h *Handler) updateAttributeSchema(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	au, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !au.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	var request organization.AttributeSchemaUpdateRequest
+	err = c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	org, err := h.manager.UpdateAttributeSchema(ctx, au.OrganizationID, &request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, org)
+}
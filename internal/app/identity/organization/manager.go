@@ -3,29 +3,174 @@ package organization
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/kamva/mgm/v3"
 	"github.com/kamva/mgm/v3/field"
+	"github.com/superstackhq/identity/internal/app/identity/attribute"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
+	"github.com/superstackhq/identity/internal/app/identity/naming"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/pkg/organization"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
 )
 
+const ownershipTransferValidity = 7 * 24 * time.Hour
+
 type Manager struct {
+	membershipManager *membership.Manager
 }
 
-func NewManager() *Manager {
-	return &Manager{}
+func NewManager(membershipManager *membership.Manager) *Manager {
+	return &Manager{
+		membershipManager: membershipManager,
+	}
+}
+
+func (m *Manager) EnsureIndexes(ctx context.Context) error {
+	_, err := mgm.Coll(&Organization{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "name_key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"deleted": false}),
+		},
+	})
+
+	return err
 }
 
+// MigrateSlugs gives organizations created before they had slugs one, in
+// the order they were created. Organizations whose names only differ in case
+// from an older one get their slug appended to the name, so that names can be
+// indexed.
+func (m *Manager) MigrateSlugs(ctx context.Context) error {
+	var orgs []*Organization
+
+	err := mgm.Coll(&Organization{}).SimpleFindWithCtx(ctx, &orgs, bson.M{
+		"slug": bson.M{"$in": bson.A{nil, ""}},
+	}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: field.ID, Value: 1}}))
+
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		org.Slug, err = m.availableSlug(ctx, org.Name)
+
+		if err != nil {
+			return err
+		}
+
+		org.NameKey = naming.NameKey(org.Name)
+
+		if !org.Deleted {
+			taken, err := m.nameTaken(ctx, org.NameKey, org.ID)
+
+			if err != nil {
+				return err
+			}
+
+			if taken {
+				name := fmt.Sprintf("%s (%s)", org.Name, org.Slug)
+
+				zap.L().Warn("renaming organization with duplicate name", zap.String("organization", org.ID.Hex()),
+					zap.String("name", org.Name), zap.String("renamed", name))
+
+				org.Name = name
+				org.NameKey = naming.NameKey(name)
+			}
+		}
+
+		err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateOwners gives organizations created before they had owners one: the
+// creator if they are still an active admin, otherwise the oldest active
+// admin.
+func (m *Manager) MigrateOwners(ctx context.Context) error {
+	var orgs []*Organization
+
+	err := mgm.Coll(&Organization{}).SimpleFindWithCtx(ctx, &orgs, bson.M{
+		"owner_id": bson.M{"$in": bson.A{nil, ""}},
+		"deleted":  false,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		creator, err := m.membershipManager.Get(ctx, org.CreatorID, org.ID.Hex())
+
+		if err == nil && creator.Admin && creator.Status == membership.StatusActive {
+			org.OwnerID = creator.UserID
+		} else {
+			admin, err := m.membershipManager.OldestAdmin(ctx, org.ID.Hex())
+
+			if err != nil {
+				return err
+			}
+
+			if admin == nil {
+				zap.L().Warn("organization has no admin to own it", zap.String("organization", org.ID.Hex()))
+				continue
+			}
+
+			org.OwnerID = admin.UserID
+		}
+
+		err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Save creates the organization with a slug derived from its name. Names
+// that only differ in case from an existing organization are refused.
 func (m *Manager) Save(ctx context.Context, name string, creatorID string) (*Organization, error) {
+	slug, err := m.availableSlug(ctx, name)
+
+	if err != nil {
+		return nil, err
+	}
+
 	organization := &Organization{
-		Name:      name,
-		CreatorID: creatorID,
-		Deleted:   false,
+		Slug:           slug,
+		Name:           name,
+		NameKey:        naming.NameKey(name),
+		CreatorID:      creatorID,
+		OwnerID:        creatorID,
+		PasswordPolicy: password.DefaultPolicy(),
+		Deleted:        false,
 	}
 
-	err := mgm.Coll(organization).CreateWithCtx(ctx, organization)
+	err = mgm.Coll(organization).CreateWithCtx(ctx, organization)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("organization %s already exists", name)
+	}
 
 	if err != nil {
 		return nil, err
@@ -34,16 +179,60 @@ func (m *Manager) Save(ctx context.Context, name string, creatorID string) (*Org
 	return organization, nil
 }
 
+// GetBySlug returns the organization the slug belongs to.
+func (m *Manager) GetBySlug(ctx context.Context, slug string) (*Organization, error) {
+	org, err := m.first(ctx, bson.M{
+		"slug":    strings.ToLower(strings.TrimSpace(slug)),
+		"deleted": false,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if org == nil {
+		return nil, fmt.Errorf("organization %s not found", slug)
+	}
+
+	return org, nil
+}
+
+// GetByName returns the organization with the name, ignoring case.
 func (m *Manager) GetByName(ctx context.Context, name string) (*Organization, error) {
+	org, err := m.first(ctx, bson.M{
+		"name_key": naming.NameKey(name),
+		"deleted":  false,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if org == nil {
+		return nil, fmt.Errorf("organization %s not found", name)
+	}
+
+	return org, nil
+}
+
+// Lookup returns the organization with the slug or, for clients that still
+// identify organizations by name, the one with the name. The two are never
+// mixed, since the slug of one organization can be the name of another.
+func (m *Manager) Lookup(ctx context.Context, slug string, name string) (*Organization, error) {
+	if len(slug) != 0 {
+		return m.GetBySlug(ctx, slug)
+	}
+
+	return m.GetByName(ctx, name)
+}
+
+func (m *Manager) first(ctx context.Context, filter bson.M) (*Organization, error) {
 	organization := &Organization{}
 
-	err := mgm.Coll(organization).FirstWithCtx(ctx, bson.M{
-		"name":    name,
-		"deleted": false,
-	}, organization)
+	err := mgm.Coll(organization).FirstWithCtx(ctx, filter, organization)
 
 	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("organization %s not found", name)
+		return nil, nil
 	}
 
 	if err != nil {
@@ -78,10 +267,282 @@ func (m *Manager) Get(ctx context.Context, organizationID string) (*Organization
 	return organization, nil
 }
 
+// NameExists reports whether an organization that is not deleted has the
+// name, ignoring case.
 func (m *Manager) NameExists(ctx context.Context, name string) (bool, error) {
+	return m.nameTaken(ctx, naming.NameKey(name), primitive.NilObjectID)
+}
+
+// nameTaken reports whether an organization other than the excluded one
+// that is not deleted has a name with the key.
+func (m *Manager) nameTaken(ctx context.Context, nameKey string, excludedID primitive.ObjectID) (bool, error) {
 	count, err := mgm.Coll(&Organization{}).CountDocuments(ctx, bson.M{
-		"name":    name,
-		"deleted": false,
+		"name_key": nameKey,
+		"deleted":  false,
+		field.ID:   bson.M{"$ne": excludedID},
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
+// availableSlug derives a slug from the name that no organization, deleted
+// or not, has used yet, appending a number if it has to.
+func (m *Manager) availableSlug(ctx context.Context, name string) (string, error) {
+	base := naming.Slug(name)
+
+	for i := 1; ; i++ {
+		slug := base
+
+		if i > 1 {
+			slug = naming.SlugWithSuffix(base, strconv.Itoa(i))
+		}
+
+		count, err := mgm.Coll(&Organization{}).CountDocuments(ctx, bson.M{"slug": slug})
+
+		if err != nil {
+			return "", err
+		}
+
+		if count == 0 {
+			return slug, nil
+		}
+	}
+}
+
+func (m *Manager) UpdatePasswordPolicy(ctx context.Context, organizationID string, request *organization.PasswordPolicyUpdateRequest) (*Organization, error) {
+	org, err := m.Get(ctx, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	org.PasswordPolicy = &password.Policy{
+		MinLength:        request.MinLength,
+		RequireUppercase: request.RequireUppercase,
+		RequireLowercase: request.RequireLowercase,
+		RequireDigit:     request.RequireDigit,
+		RequireSymbol:    request.RequireSymbol,
+		MaxAgeDays:       request.MaxAgeDays,
+		DisallowUsername: request.DisallowUsername,
+		HistoryDepth:     request.HistoryDepth,
+	}
+
+	err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// Update changes the name, branding, contact and settings of the
+// organization. The new name must not belong to another organization.
+func (m *Manager) Update(ctx context.Context, organizationID string, request *organization.UpdateRequest) (*Organization, error) {
+	org, err := m.Get(ctx, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Name != nil && *request.Name != org.Name {
+		nameKey := naming.NameKey(*request.Name)
+		exists, err := m.nameTaken(ctx, nameKey, org.ID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if exists {
+			return nil, fmt.Errorf("organization %s already exists", *request.Name)
+		}
+
+		org.Name = *request.Name
+		org.NameKey = nameKey
+	}
+
+	if request.DisplayName != nil {
+		org.DisplayName = *request.DisplayName
+	}
+
+	if request.LogoURL != nil {
+		org.LogoURL = *request.LogoURL
+	}
+
+	if request.ContactEmail != nil {
+		org.ContactEmail = strings.ToLower(strings.TrimSpace(*request.ContactEmail))
+	}
+
+	if request.Settings != nil {
+		settings := Settings{
+			DefaultTimezone:     request.Settings.DefaultTimezone,
+			AllowedEmailDomains: request.Settings.AllowedEmailDomains,
+		}
+
+		if len(request.Settings.DefaultLocale) != 0 {
+			tag, err := language.Parse(request.Settings.DefaultLocale)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid locale %s", request.Settings.DefaultLocale)
+			}
+
+			settings.DefaultLocale = tag.String()
+		}
+
+		if len(settings.DefaultTimezone) != 0 {
+			_, err = time.LoadLocation(settings.DefaultTimezone)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid timezone %s", settings.DefaultTimezone)
+			}
+		}
+
+		org.Settings = settings
+	}
+
+	err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("organization %s already exists", org.Name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// RequestOwnershipTransfer offers the organization to another active member.
+// Only the owner can do so, and the transfer takes effect once the member
+// accepts it.
+func (m *Manager) RequestOwnershipTransfer(ctx context.Context, request *organization.OwnershipTransferRequest, actor *authentication.AuthenticatedActor) (*Organization, error) {
+	org, err := m.Get(ctx, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if org.OwnerID != actor.ActorID {
+		return nil, fmt.Errorf("only the owner can transfer the organization")
+	}
+
+	if request.UserID == org.OwnerID {
+		return nil, fmt.Errorf("user %s already owns the organization", request.UserID)
+	}
+
+	ms, err := m.membershipManager.Get(ctx, request.UserID, org.ID.Hex())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.Status != membership.StatusActive {
+		return nil, fmt.Errorf("user %s is not active", request.UserID)
+	}
+
+	now := time.Now().UTC()
+
+	org.OwnershipTransfer = &OwnershipTransfer{
+		UserID:      request.UserID,
+		RequestedAt: now,
+		ExpiresAt:   now.Add(ownershipTransferValidity),
+	}
+
+	err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// AcceptOwnershipTransfer makes the actor the owner of the organization if a
+// transfer to them is pending. The new owner becomes an admin, and the
+// previous owner stays one.
+func (m *Manager) AcceptOwnershipTransfer(ctx context.Context, actor *authentication.AuthenticatedActor) (*Organization, error) {
+	org, err := m.Get(ctx, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := org.OwnershipTransfer
+
+	if transfer == nil || transfer.UserID != actor.ActorID || time.Now().After(transfer.ExpiresAt) {
+		return nil, fmt.Errorf("no ownership transfer to you is pending")
+	}
+
+	ms, err := m.membershipManager.Get(ctx, actor.ActorID, org.ID.Hex())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.Status != membership.StatusActive {
+		return nil, fmt.Errorf("user %s is not active", actor.ActorID)
+	}
+
+	if !ms.Admin {
+		ms.Admin = true
+
+		err = m.membershipManager.Update(ctx, ms)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	org.OwnerID = actor.ActorID
+	org.OwnershipTransfer = nil
+
+	err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// CancelOwnershipTransfer withdraws a pending transfer. The owner can cancel
+// it and the member it was offered to can decline it.
+func (m *Manager) CancelOwnershipTransfer(ctx context.Context, actor *authentication.AuthenticatedActor) (*Organization, error) {
+	org, err := m.Get(ctx, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if org.OwnershipTransfer == nil {
+		return nil, fmt.Errorf("no ownership transfer is pending")
+	}
+
+	if actor.ActorID != org.OwnerID && actor.ActorID != org.OwnershipTransfer.UserID {
+		return nil, fmt.Errorf("only the owner or the new owner can cancel the transfer")
+	}
+
+	org.OwnershipTransfer = nil
+
+	err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// OwnsAny reports whether the user owns an organization that is not deleted.
+func (m *Manager) OwnsAny(ctx context.Context, userID string) (bool, error) {
+	count, err := mgm.Coll(&Organization{}).CountDocuments(ctx, bson.M{
+		"owner_id": userID,
+		"deleted":  false,
 	})
 
 	if err != nil {
@@ -90,3 +551,151 @@ func (m *Manager) NameExists(ctx context.Context, name string) (bool, error) {
 
 	return count != 0, nil
 }
+
+// MarkDeleted soft deletes the organization. Its name becomes available to
+// others until it is restored.
+func (m *Manager) MarkDeleted(ctx context.Context, org *Organization, deleterID string) error {
+	now := time.Now().UTC()
+
+	org.Deleted = true
+	org.DeletedAt = &now
+	org.DeleterID = deleterID
+
+	return mgm.Coll(org).UpdateWithCtx(ctx, org)
+}
+
+// GetDeleted returns a soft deleted organization.
+func (m *Manager) GetDeleted(ctx context.Context, organizationID string) (*Organization, error) {
+	id, err := primitive.ObjectIDFromHex(organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	organization := &Organization{}
+
+	err = mgm.Coll(organization).FirstWithCtx(ctx, bson.M{
+		field.ID:  id,
+		"deleted": true,
+	}, organization)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("deleted organization not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+// MarkRestored undoes MarkDeleted, unless another organization has taken the
+// name in the meantime.
+func (m *Manager) MarkRestored(ctx context.Context, org *Organization) error {
+	exists, err := m.nameTaken(ctx, org.NameKey, org.ID)
+
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return fmt.Errorf("organization %s has been taken since it was deleted", org.Name)
+	}
+
+	org.Deleted = false
+	org.DeletedAt = nil
+	org.DeleterID = ""
+
+	err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("organization %s has been taken since it was deleted", org.Name)
+	}
+
+	return err
+}
+
+// UpdateAttributeSchema replaces the custom user attributes of the
+// organization. Values of removed attributes stay on users until their
+// metadata is next updated.
+func (m *Manager) UpdateAttributeSchema(ctx context.Context, organizationID string, request *organization.AttributeSchemaUpdateRequest) (*Organization, error) {
+	org, err := m.Get(ctx, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(attribute.Schema, 0, len(request.Attributes))
+
+	for _, a := range request.Attributes {
+		schema = append(schema, &attribute.Definition{
+			Key:         a.Key,
+			Type:        attribute.Type(strings.ToUpper(a.Type)),
+			Description: a.Description,
+			Required:    a.Required,
+			Values:      a.Values,
+			Pattern:     a.Pattern,
+			Min:         a.Min,
+			Max:         a.Max,
+			Claim:       a.Claim,
+		})
+	}
+
+	err = schema.Check()
+
+	if err != nil {
+		return nil, err
+	}
+
+	org.AttributeSchema = schema
+
+	err = mgm.Coll(org).UpdateWithCtx(ctx, org)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return org, nil
+}
+
+// Pseudonymise replaces references to the user with the pseudonym.
+func (m *Manager) Pseudonymise(ctx context.Context, userID string, pseudonym string) error {
+	_, err := mgm.Coll(&Organization{}).UpdateMany(ctx, bson.M{
+		"creator_id": userID,
+	}, bson.M{
+		"$set": bson.M{"creator_id": pseudonym},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = mgm.Coll(&Organization{}).UpdateMany(ctx, bson.M{
+		"deleter_id": userID,
+	}, bson.M{
+		"$set": bson.M{"deleter_id": pseudonym},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = mgm.Coll(&Organization{}).UpdateMany(ctx, bson.M{
+		"owner_id": userID,
+	}, bson.M{
+		"$set": bson.M{"owner_id": pseudonym},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = mgm.Coll(&Organization{}).UpdateMany(ctx, bson.M{
+		"ownership_transfer.user_id": userID,
+	}, bson.M{
+		"$set": bson.M{"ownership_transfer": nil},
+	})
+
+	return err
+}
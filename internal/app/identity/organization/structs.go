@@ -1,10 +1,84 @@
 package organization
 
-import "github.com/kamva/mgm/v3"
+import (
+	"context"
+	"strings"
+	"time"
 
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/internal/app/identity/attribute"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/pkg/organization"
+)
+
+// Organization is identified in URLs and at login by its slug, which is
+// derived from the name it was created with and never changes. Names are
+// unique regardless of case among organizations that are not deleted.
 type Organization struct {
-	mgm.DefaultModel `bson:",inline"`
-	Name             string `json:"name" bson:"name"`
-	CreatorID        string `json:"creator_id" bson:"creator_id"`
-	Deleted          bool   `json:"deleted" bson:"deleted"`
+	mgm.DefaultModel  `bson:",inline"`
+	Slug              string             `json:"slug" bson:"slug"`
+	Name              string             `json:"name" bson:"name"`
+	NameKey           string             `json:"-" bson:"name_key"`
+	DisplayName       string             `json:"display_name" bson:"display_name"`
+	LogoURL           string             `json:"logo_url" bson:"logo_url"`
+	ContactEmail      string             `json:"contact_email" bson:"contact_email"`
+	Settings          Settings           `json:"settings" bson:"settings"`
+	CreatorID         string             `json:"creator_id" bson:"creator_id"`
+	OwnerID           string             `json:"owner_id" bson:"owner_id"`
+	OwnershipTransfer *OwnershipTransfer `json:"ownership_transfer" bson:"ownership_transfer"`
+	PasswordPolicy    *password.Policy   `json:"password_policy" bson:"password_policy"`
+	AttributeSchema   attribute.Schema   `json:"attribute_schema" bson:"attribute_schema"`
+	Deleted           bool               `json:"deleted" bson:"deleted"`
+	DeletedAt         *time.Time         `json:"deleted_at" bson:"deleted_at"`
+	DeleterID         string             `json:"deleter_id,omitempty" bson:"deleter_id,omitempty"`
+}
+
+// OwnershipTransfer is a pending handover of the organization that the new
+// owner has to accept before it expires.
+type OwnershipTransfer struct {
+	UserID      string    `json:"user_id" bson:"user_id"`
+	RequestedAt time.Time `json:"requested_at" bson:"requested_at"`
+	ExpiresAt   time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// Settings apply to every member of the organization.
+type Settings struct {
+	DefaultLocale       string   `json:"default_locale" bson:"default_locale"`
+	DefaultTimezone     string   `json:"default_timezone" bson:"default_timezone"`
+	AllowedEmailDomains []string `json:"allowed_email_domains" bson:"allowed_email_domains"`
+}
+
+// Lifecycle deletes and restores organizations together with everything
+// that belongs to them. The user manager implements it, since deletion
+// cascades to users.
+type Lifecycle interface {
+	DeleteOrganization(ctx context.Context, actor *authentication.AuthenticatedActor) (*organization.DeletionResponse, error)
+	RestoreOrganization(ctx context.Context, request *organization.RestoreRequest) (*Organization, error)
+}
+
+func (o *Organization) EffectivePasswordPolicy() *password.Policy {
+	if o.PasswordPolicy == nil {
+		return password.DefaultPolicy()
+	}
+
+	return o.PasswordPolicy
+}
+
+// AllowsEmail reports whether users with the email can be added to the
+// organization.
+func (s *Settings) AllowsEmail(email string) bool {
+	if len(s.AllowedEmailDomains) == 0 {
+		return true
+	}
+
+	domain := email[strings.LastIndex(email, "@")+1:]
+
+	for _, allowed := range s.AllowedEmailDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,200 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultSize = 50
+	maxSize     = 200
+)
+
+// Parse reads the cursor and size query parameters of a list request.
+func Parse(c *gin.Context) (*Request, error) {
+	size, err := strconv.ParseInt(c.DefaultQuery("size", strconv.Itoa(defaultSize)), 10, 64)
+
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("invalid page size")
+	}
+
+	if size > maxSize {
+		size = maxSize
+	}
+
+	request := &Request{Size: size}
+
+	if encoded := c.Query("cursor"); len(encoded) != 0 {
+		request.Cursor, err = Decode(encoded)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return request, nil
+}
+
+func Encode(cursor *Cursor) (string, error) {
+	raw, err := bson.Marshal(cursor)
+
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func Decode(encoded string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	cursor := &Cursor{}
+
+	if err = bson.Unmarshal(raw, cursor); err != nil || cursor.ID.IsZero() {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	// Values end up in filters, so documents and other values that could
+	// carry query operators or code are refused.
+	switch cursor.Value.(type) {
+	case nil, string, bool, int32, int64, float64, primitive.DateTime:
+	default:
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return cursor, nil
+}
+
+// Check rejects a cursor whose value does not have the type of the sort
+// field, given by a sample value of it, such as a cursor made for another
+// sort order.
+func (r *Request) Check(field string, sample interface{}) error {
+	if r.Cursor == nil {
+		return nil
+	}
+
+	if field == "_id" {
+		if r.Cursor.Value != nil {
+			return fmt.Errorf("invalid cursor")
+		}
+
+		return nil
+	}
+
+	if kind := valueKind(r.Cursor.Value); len(kind) == 0 || kind != valueKind(sample) {
+		return fmt.Errorf("invalid cursor")
+	}
+
+	return nil
+}
+
+// valueKind names the kind of a scalar sort value, or is empty for values
+// that cannot be sorted by.
+func valueKind(value interface{}) string {
+	switch value.(type) {
+	case time.Time, primitive.DateTime:
+		return "date"
+	case nil:
+		return ""
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Float64:
+		return "number"
+	}
+
+	return ""
+}
+
+// Filter restricts the filter to the items after the cursor in the order
+// given by the sort field, using the id to break ties.
+func (r *Request) Filter(filter bson.M, field string, descending bool) bson.M {
+	if r.Cursor == nil {
+		return filter
+	}
+
+	operator := "$gt"
+
+	if descending {
+		operator = "$lt"
+	}
+
+	after := bson.M{"_id": bson.M{operator: r.Cursor.ID}}
+
+	if field != "_id" {
+		after = bson.M{"$or": bson.A{
+			bson.M{field: bson.M{operator: r.Cursor.Value}},
+			bson.M{field: r.Cursor.Value, "_id": bson.M{operator: r.Cursor.ID}},
+		}}
+	}
+
+	return bson.M{"$and": bson.A{filter, after}}
+}
+
+// Options sorts by the field and id and fetches one item more than the page
+// size, so that callers can tell whether another page follows.
+func (r *Request) Options(field string, descending bool) *options.FindOptions {
+	direction := 1
+
+	if descending {
+		direction = -1
+	}
+
+	sort := bson.D{{Key: "_id", Value: direction}}
+
+	if field != "_id" {
+		sort = append(bson.D{{Key: field, Value: direction}}, sort...)
+	}
+
+	return options.Find().SetSort(sort).SetLimit(r.Size + 1)
+}
+
+// More reports whether count items were fetched with the options of the
+// request, i.e. whether the page has to be trimmed and continued.
+func (r *Request) More(count int) bool {
+	return int64(count) > r.Size
+}
+
+// Next builds the cursor for the page that follows the item with the given
+// id and sort value.
+func Next(id primitive.ObjectID, value interface{}) (string, error) {
+	return Encode(&Cursor{ID: id, Value: value})
+}
+
+// Respond writes the page wrapped in the list envelope.
+func Respond(c *gin.Context, page *Page) {
+	links := Links{Self: c.Request.URL.RequestURI()}
+
+	if page.HasMore {
+		next := *c.Request.URL
+		query := next.Query()
+		query.Set("cursor", page.NextCursor)
+		next.RawQuery = query.Encode()
+		links.Next = next.RequestURI()
+	}
+
+	c.JSON(http.StatusOK, &Response{
+		Items:      page.Items,
+		Total:      page.Total,
+		HasMore:    page.HasMore,
+		NextCursor: page.NextCursor,
+		Links:      links,
+	})
+}
@@ -0,0 +1,298 @@
+package pagination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type item struct {
+	ID    primitive.ObjectID
+	Value interface{}
+}
+
+// comparable turns sort values into something that compares like MongoDB
+// compares them.
+func comparable(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		return primitive.NewDateTimeFromTime(v).Time().UnixMilli()
+	case primitive.DateTime:
+		return v.Time().UnixMilli()
+	case primitive.ObjectID:
+		return v.Hex()
+	}
+
+	return value
+}
+
+func compare(a interface{}, b interface{}) int {
+	switch a := comparable(a).(type) {
+	case string:
+		return bytes.Compare([]byte(a), []byte(comparable(b).(string)))
+	case int64:
+		b := comparable(b).(int64)
+
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+
+		return 0
+	}
+
+	panic(fmt.Sprintf("cannot compare %T", a))
+}
+
+func (i *item) get(field string) interface{} {
+	if field == "_id" {
+		return i.ID
+	}
+
+	return i.Value
+}
+
+// matches evaluates the subset of the query language that Filter produces.
+func (i *item) matches(filter bson.M) bool {
+	for key, condition := range filter {
+		switch key {
+		case "$and":
+			for _, clause := range condition.(bson.A) {
+				if !i.matches(clause.(bson.M)) {
+					return false
+				}
+			}
+		case "$or":
+			matched := false
+
+			for _, clause := range condition.(bson.A) {
+				matched = matched || i.matches(clause.(bson.M))
+			}
+
+			if !matched {
+				return false
+			}
+		default:
+			operators, ok := condition.(bson.M)
+
+			if !ok {
+				if compare(i.get(key), condition) != 0 {
+					return false
+				}
+
+				continue
+			}
+
+			for operator, operand := range operators {
+				c := compare(i.get(key), operand)
+
+				if (operator == "$gt" && c <= 0) || (operator == "$lt" && c >= 0) {
+					return false
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+func find(items []*item, request *Request, field string, descending bool) []*item {
+	options := request.Options(field, descending)
+	order := options.Sort.(bson.D)
+
+	var found []*item
+
+	for _, i := range items {
+		if i.matches(request.Filter(bson.M{}, field, descending)) {
+			found = append(found, i)
+		}
+	}
+
+	sort.Slice(found, func(a, b int) bool {
+		for _, e := range order {
+			c := compare(found[a].get(e.Key), found[b].get(e.Key))
+
+			if c != 0 {
+				return c*e.Value.(int) < 0
+			}
+		}
+
+		return false
+	})
+
+	if int64(len(found)) > *options.Limit {
+		found = found[:*options.Limit]
+	}
+
+	return found
+}
+
+// pageThrough collects every item by following the cursors from page to
+// page, encoding and decoding them like clients do.
+func pageThrough(t *testing.T, items []*item, size int64, field string, descending bool) []*item {
+	var collected []*item
+	request := &Request{Size: size}
+
+	for pages := 0; pages <= len(items); pages++ {
+		found := find(items, request, field, descending)
+
+		if !request.More(len(found)) {
+			return append(collected, found...)
+		}
+
+		found = found[:size]
+		collected = append(collected, found...)
+		last := found[len(found)-1]
+
+		var value interface{}
+
+		if field != "_id" {
+			value = last.Value
+		}
+
+		encoded, err := Next(last.ID, value)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cursor, err := Decode(encoded)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request = &Request{Size: size, Cursor: cursor}
+
+		if err = request.Check(field, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Fatal("paging did not end")
+	return nil
+}
+
+func TestPagingAcrossTiedValues(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	var strings, times []*item
+
+	for n, value := range []string{"b", "a", "b", "c", "b", "a", "b", "b", "c", "a"} {
+		strings = append(strings, &item{ID: primitive.NewObjectID(), Value: value})
+		times = append(times, &item{ID: primitive.NewObjectID(), Value: now.Add(time.Duration(n%3) * time.Second)})
+	}
+
+	for _, test := range []struct {
+		name  string
+		items []*item
+		field string
+	}{
+		{"strings", strings, "value"},
+		{"times", times, "value"},
+		{"ids", strings, "_id"},
+	} {
+		for _, descending := range []bool{false, true} {
+			for _, size := range []int64{1, 2, 3, 4, 10, 20} {
+				t.Run(fmt.Sprintf("%s/descending=%v/size=%d", test.name, descending, size), func(t *testing.T) {
+					want := find(test.items, &Request{Size: int64(len(test.items))}, test.field, descending)
+					got := pageThrough(t, test.items, size, test.field, descending)
+
+					if len(got) != len(want) {
+						t.Fatalf("got %d items, want %d", len(got), len(want))
+					}
+
+					for n := range want {
+						if got[n] != want[n] {
+							t.Fatalf("item %d is %v, want %v", n, got[n].ID, want[n].ID)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestDecodeRejectsInvalidCursors(t *testing.T) {
+	encode := func(document interface{}) string {
+		raw, err := bson.Marshal(document)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+
+	id := primitive.NewObjectID()
+
+	for name, encoded := range map[string]string{
+		"not base64":    "!!!",
+		"not bson":      base64.RawURLEncoding.EncodeToString([]byte("cursor")),
+		"missing id":    encode(bson.M{"value": "a"}),
+		"operator":      encode(bson.M{"id": id, "value": bson.M{"$exists": true}}),
+		"array":         encode(bson.M{"id": id, "value": bson.A{"a", "b"}}),
+		"regex":         encode(bson.M{"id": id, "value": primitive.Regex{Pattern: ".*"}}),
+		"javascript":    encode(bson.M{"id": id, "value": primitive.JavaScript("true")}),
+		"nested object": encode(bson.M{"id": id, "value": bson.D{{Key: "a", Value: 1}}}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decode(encoded); err == nil {
+				t.Errorf("Decode(%q) succeeded", encoded)
+			}
+		})
+	}
+}
+
+func TestCheckRejectsMistypedValues(t *testing.T) {
+	id := primitive.NewObjectID()
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		field  string
+		value  interface{}
+		sample interface{}
+		valid  bool
+	}{
+		{"id", "_id", nil, nil, true},
+		{"id with value", "_id", "a", nil, false},
+		{"string", "username", "a", "", true},
+		{"time", "created_at", now, time.Time{}, true},
+		{"bool", "admin", true, false, true},
+		{"missing value", "username", nil, "", false},
+		{"string for time", "created_at", "a", time.Time{}, false},
+		{"time for string", "username", now, "", false},
+		{"number for bool", "admin", int32(1), false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded, err := Next(id, test.value)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cursor, err := Decode(encoded)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = (&Request{Size: 1, Cursor: cursor}).Check(test.field, test.sample)
+
+			if (err == nil) != test.valid {
+				t.Errorf("Check error = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package pagination
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Cursor points at the last item of a page. Value holds the sort field of
+// that item when the list is not sorted by id alone.
+type Cursor struct {
+	ID    primitive.ObjectID `bson:"id"`
+	Value interface{}        `bson:"value,omitempty"`
+}
+
+type Request struct {
+	Cursor *Cursor
+	Size   int64
+}
+
+type Page struct {
+	Items      interface{}
+	Total      int64
+	HasMore    bool
+	NextCursor string
+}
+
+type Links struct {
+	Self string `json:"self"`
+	Next string `json:"next,omitempty"`
+}
+
+type Response struct {
+	Items      interface{} `json:"items"`
+	Total      int64       `json:"total"`
+	HasMore    bool        `json:"has_more"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Links      Links       `json:"links"`
+}
@@ -0,0 +1,192 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+	saltLength     = 16
+	keyLength      = 32
+)
+
+// Bounds of the parameters accepted in stored hashes, so that a hash cannot
+// make verification exhaust memory or CPU.
+const (
+	maxArgon2idMemory      = 256 * 1024
+	maxArgon2idIterations  = 16
+	maxArgon2idParallelism = 16
+	minSaltLength          = 8
+	maxSaltLength          = 64
+	minKeyLength           = 16
+	maxKeyLength           = 64
+)
+
+type Argon2idParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func DefaultArgon2idParams() Argon2idParams {
+	return Argon2idParams{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+	}
+}
+
+type Argon2id struct {
+	params Argon2idParams
+}
+
+func NewArgon2id(params Argon2idParams) *Argon2id {
+	defaults := DefaultArgon2idParams()
+
+	if params.Memory == 0 {
+		params.Memory = defaults.Memory
+	}
+
+	if params.Iterations == 0 {
+		params.Iterations = defaults.Iterations
+	}
+
+	if params.Parallelism == 0 {
+		params.Parallelism = defaults.Parallelism
+	}
+
+	// Hashes with parameters out of bounds could not be verified.
+	if checkArgon2idParams(params) != nil {
+		params = defaults
+	}
+
+	return &Argon2id{
+		params: params,
+	}
+}
+
+func (a *Argon2id) Supports(hash string) bool {
+	return strings.HasPrefix(hash, argon2idPrefix)
+}
+
+func (a *Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, saltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.params.Iterations, a.params.Memory, a.params.Parallelism, keyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		a.params.Memory,
+		a.params.Iterations,
+		a.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *Argon2id) Verify(hash string, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+func (a *Argon2id) Check(hash string) error {
+	_, _, _, err := decodeArgon2id(hash)
+	return err
+}
+
+func (a *Argon2id) Outdated(hash string) bool {
+	params, _, _, err := decodeArgon2id(hash)
+
+	return err != nil || params != a.params
+}
+
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+	var version int
+
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, err
+	}
+
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, err
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil {
+		return params, nil, nil, err
+	}
+
+	if err = checkArgon2idParams(params); err != nil {
+		return params, nil, nil, err
+	}
+
+	if err = checkSaltAndKey(salt, key); err != nil {
+		return params, nil, nil, err
+	}
+
+	return params, salt, key, nil
+}
+
+func checkArgon2idParams(params Argon2idParams) error {
+	if params.Iterations == 0 || params.Iterations > maxArgon2idIterations {
+		return fmt.Errorf("argon2id iterations must be between 1 and %d", maxArgon2idIterations)
+	}
+
+	if params.Parallelism == 0 || params.Parallelism > maxArgon2idParallelism {
+		return fmt.Errorf("argon2id parallelism must be between 1 and %d", maxArgon2idParallelism)
+	}
+
+	// Argon2 needs at least 8 KiB per lane.
+	if params.Memory < 8*uint32(params.Parallelism) || params.Memory > maxArgon2idMemory {
+		return fmt.Errorf("argon2id memory must be between %d and %d KiB", 8*uint32(params.Parallelism), maxArgon2idMemory)
+	}
+
+	return nil
+}
+
+func checkSaltAndKey(salt []byte, key []byte) error {
+	if len(salt) < minSaltLength || len(salt) > maxSaltLength {
+		return fmt.Errorf("salt must be between %d and %d bytes long", minSaltLength, maxSaltLength)
+	}
+
+	if len(key) < minKeyLength || len(key) > maxKeyLength {
+		return fmt.Errorf("key must be between %d and %d bytes long", minKeyLength, maxKeyLength)
+	}
+
+	return nil
+}
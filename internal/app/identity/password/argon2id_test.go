@@ -0,0 +1,113 @@
+package password
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	params := Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1}
+	a := NewArgon2id(params)
+
+	hash, err := a.Hash("correct horse")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, salt, key, err := decodeArgon2id(hash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != params || len(salt) != saltLength || len(key) != keyLength {
+		t.Fatalf("decoded %+v with %d byte salt and %d byte key", decoded, len(salt), len(key))
+	}
+
+	for password, want := range map[string]bool{"correct horse": true, "wrong horse": false, "": false} {
+		ok, err := a.Verify(hash, password)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != want {
+			t.Errorf("Verify(%q) = %v, want %v", password, ok, want)
+		}
+	}
+
+	if a.Outdated(hash) {
+		t.Error("hash with current parameters is outdated")
+	}
+
+	if !NewArgon2id(Argon2idParams{Memory: 128, Iterations: 1, Parallelism: 1}).Outdated(hash) {
+		t.Error("hash with other parameters is not outdated")
+	}
+}
+
+func TestDecodeArgon2id(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString(make([]byte, saltLength))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, keyLength))
+
+	hash := func(params string, salt string, key string) string {
+		return fmt.Sprintf("$argon2id$v=19$%s$%s$%s", params, salt, key)
+	}
+
+	tests := []struct {
+		name  string
+		hash  string
+		valid bool
+	}{
+		{"valid", hash("m=65536,t=3,p=2", salt, key), true},
+		{"bounds", hash("m=262144,t=16,p=16", salt, key), true},
+		{"empty", "", false},
+		{"wrong algorithm", strings.Replace(hash("m=65536,t=3,p=2", salt, key), "argon2id", "argon2i", 1), false},
+		{"missing part", "$argon2id$v=19$m=65536,t=3,p=2$" + salt, false},
+		{"wrong version", strings.Replace(hash("m=65536,t=3,p=2", salt, key), "v=19", "v=16", 1), false},
+		{"malformed params", hash("m=65536;t=3;p=2", salt, key), false},
+		{"malformed salt", hash("m=65536,t=3,p=2", "!!!", key), false},
+		{"malformed key", hash("m=65536,t=3,p=2", salt, "!!!"), false},
+		{"zero memory", hash("m=0,t=3,p=2", salt, key), false},
+		{"memory below lanes", hash("m=8,t=3,p=2", salt, key), false},
+		{"huge memory", hash("m=4294967295,t=3,p=2", salt, key), false},
+		{"zero iterations", hash("m=65536,t=0,p=2", salt, key), false},
+		{"huge iterations", hash("m=65536,t=1000000,p=2", salt, key), false},
+		{"zero parallelism", hash("m=65536,t=3,p=0", salt, key), false},
+		{"huge parallelism", hash("m=65536,t=3,p=255", salt, key), false},
+		{"empty salt", hash("m=65536,t=3,p=2", "", key), false},
+		{"long salt", hash("m=65536,t=3,p=2", base64.RawStdEncoding.EncodeToString(make([]byte, 65)), key), false},
+		{"empty key", hash("m=65536,t=3,p=2", salt, ""), false},
+		{"short key", hash("m=65536,t=3,p=2", salt, base64.RawStdEncoding.EncodeToString(make([]byte, 4))), false},
+		{"long key", hash("m=65536,t=3,p=2", salt, base64.RawStdEncoding.EncodeToString(make([]byte, 1024))), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, _, err := decodeArgon2id(test.hash)
+
+			if (err == nil) != test.valid {
+				t.Errorf("decodeArgon2id(%q) error = %v, want valid %v", test.hash, err, test.valid)
+			}
+		})
+	}
+}
+
+func TestArgon2idVerifyRejectsEmptyKey(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString(make([]byte, saltLength))
+	ok, err := NewArgon2id(DefaultArgon2idParams()).Verify("$argon2id$v=19$m=65536,t=3,p=2$"+salt+"$", "anything")
+
+	if ok || err == nil {
+		t.Errorf("Verify = %v, %v, want false and an error", ok, err)
+	}
+}
+
+func TestNewArgon2idFallsBackToDefaults(t *testing.T) {
+	a := NewArgon2id(Argon2idParams{Memory: 1 << 30, Iterations: 3, Parallelism: 2})
+
+	if a.params != DefaultArgon2idParams() {
+		t.Errorf("params = %+v, want defaults", a.params)
+	}
+}
@@ -0,0 +1,79 @@
+package password
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxBcryptCost bounds the cost of hashes that were not produced with the
+// configured cost, since every login has to pay it.
+const maxBcryptCost = 16
+
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) *Bcrypt {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+
+	return &Bcrypt{
+		cost: cost,
+	}
+}
+
+func (b *Bcrypt) Supports(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (b *Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.cost)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (b *Bcrypt) Verify(hash string, password string) (bool, error) {
+	if err := b.Check(hash); err != nil {
+		return false, err
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (b *Bcrypt) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	return err != nil || cost < b.cost
+}
+
+func (b *Bcrypt) Check(hash string) error {
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	if err != nil {
+		return err
+	}
+
+	if cost > maxBcryptCost && cost > b.cost {
+		return fmt.Errorf("bcrypt cost %d is too high", cost)
+	}
+
+	return nil
+}
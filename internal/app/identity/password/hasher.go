@@ -0,0 +1,63 @@
+package password
+
+import (
+	"fmt"
+)
+
+type Algorithm interface {
+	Supports(hash string) bool
+	Hash(password string) (string, error)
+	Verify(hash string, password string) (bool, error)
+	Outdated(hash string) bool
+	// Check reports why the hash cannot be verified, e.g. because its cost
+	// parameters are out of bounds.
+	Check(hash string) error
+}
+
+type Hasher struct {
+	primary    Algorithm
+	algorithms []Algorithm
+}
+
+func NewHasher(primary Algorithm, legacy ...Algorithm) *Hasher {
+	return &Hasher{
+		primary:    primary,
+		algorithms: append([]Algorithm{primary}, legacy...),
+	}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+// Verify reports whether password matches hash and whether the hash should be
+// replaced with one produced by the primary algorithm.
+func (h *Hasher) Verify(hash string, password string) (bool, bool, error) {
+	for _, algorithm := range h.algorithms {
+		if !algorithm.Supports(hash) {
+			continue
+		}
+
+		ok, err := algorithm.Verify(hash, password)
+
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, algorithm != h.primary || algorithm.Outdated(hash), nil
+	}
+
+	return false, false, fmt.Errorf("unsupported password hash format")
+}
+
+// Check reports why none of the algorithms can verify the hash, if none
+// can. Hashes from other systems have to pass it before they are stored.
+func (h *Hasher) Check(hash string) error {
+	for _, algorithm := range h.algorithms {
+		if algorithm.Supports(hash) {
+			return algorithm.Check(hash)
+		}
+	}
+
+	return fmt.Errorf("unsupported password hash format")
+}
@@ -0,0 +1,141 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	pbkdf2Prefix            = "$pbkdf2"
+	pbkdf2DefaultDigest     = "sha256"
+	pbkdf2DefaultIterations = 600000
+	pbkdf2MaxIterations     = 2000000
+)
+
+// PBKDF2 verifies hashes carried over from other identity providers. Hashes
+// use the PHC string format also used by Auth0:
+// $pbkdf2-<digest>$i=<iterations>,l=<key length>$<salt>$<key>
+type PBKDF2 struct {
+}
+
+func NewPBKDF2() *PBKDF2 {
+	return &PBKDF2{}
+}
+
+func (p *PBKDF2) Supports(hash string) bool {
+	return strings.HasPrefix(hash, pbkdf2Prefix+"$") || strings.HasPrefix(hash, pbkdf2Prefix+"-")
+}
+
+func (p *PBKDF2) Hash(password string) (string, error) {
+	salt := make([]byte, saltLength)
+
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2.Key([]byte(password), salt, pbkdf2DefaultIterations, keyLength, sha256.New)
+
+	return EncodePBKDF2(pbkdf2DefaultDigest, pbkdf2DefaultIterations, salt, key), nil
+}
+
+func (p *PBKDF2) Verify(hash string, password string) (bool, error) {
+	digest, iterations, salt, key, err := decodePBKDF2(hash)
+
+	if err != nil {
+		return false, err
+	}
+
+	candidate := pbkdf2.Key([]byte(password), salt, iterations, len(key), digest)
+
+	return subtle.ConstantTimeCompare(key, candidate) == 1, nil
+}
+
+func (p *PBKDF2) Check(hash string) error {
+	_, _, _, _, err := decodePBKDF2(hash)
+	return err
+}
+
+func (p *PBKDF2) Outdated(hash string) bool {
+	_, iterations, _, _, err := decodePBKDF2(hash)
+
+	return err != nil || iterations < pbkdf2DefaultIterations
+}
+
+// EncodePBKDF2 builds the PHC string of a PBKDF2 key, so that importers can
+// store hashes exported in other layouts.
+func EncodePBKDF2(digest string, iterations int, salt []byte, key []byte) string {
+	return fmt.Sprintf("$pbkdf2-%s$i=%d,l=%d$%s$%s",
+		digest,
+		iterations,
+		len(key),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodePBKDF2(encoded string) (func() hash.Hash, int, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 5 || !strings.HasPrefix(parts[1], "pbkdf2") {
+		return nil, 0, nil, nil, fmt.Errorf("invalid pbkdf2 hash")
+	}
+
+	var digest func() hash.Hash
+
+	switch strings.TrimPrefix(parts[1], "pbkdf2") {
+	case "", "-sha1":
+		digest = sha1.New
+	case "-sha256":
+		digest = sha256.New
+	case "-sha512":
+		digest = sha512.New
+	default:
+		return nil, 0, nil, nil, fmt.Errorf("unsupported pbkdf2 digest %s", parts[1])
+	}
+
+	var iterations int
+
+	for _, param := range strings.Split(parts[2], ",") {
+		if strings.HasPrefix(param, "i=") {
+			if _, err := fmt.Sscanf(param, "i=%d", &iterations); err != nil {
+				return nil, 0, nil, nil, err
+			}
+		}
+	}
+
+	if iterations <= 0 || iterations > pbkdf2MaxIterations {
+		return nil, 0, nil, nil, fmt.Errorf("pbkdf2 iterations must be between 1 and %d", pbkdf2MaxIterations)
+	}
+
+	salt, err := decodeBase64(parts[3])
+
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	key, err := decodeBase64(parts[4])
+
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	if err = checkSaltAndKey(salt, key); err != nil {
+		return nil, 0, nil, nil, err
+	}
+
+	return digest, iterations, salt, key, nil
+}
+
+// decodeBase64 accepts base64 with or without padding.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
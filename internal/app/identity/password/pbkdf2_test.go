@@ -0,0 +1,141 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+func TestPBKDF2RoundTrip(t *testing.T) {
+	p := NewPBKDF2()
+
+	hash, err := p.Hash("correct horse")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, iterations, salt, key, err := decodePBKDF2(hash)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if iterations != pbkdf2DefaultIterations || len(salt) != saltLength || len(key) != keyLength {
+		t.Fatalf("decoded %d iterations with %d byte salt and %d byte key", iterations, len(salt), len(key))
+	}
+
+	for password, want := range map[string]bool{"correct horse": true, "wrong horse": false} {
+		ok, err := p.Verify(hash, password)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != want {
+			t.Errorf("Verify(%q) = %v, want %v", password, ok, want)
+		}
+	}
+
+	if p.Outdated(hash) {
+		t.Error("hash with default iterations is outdated")
+	}
+}
+
+func TestPBKDF2VerifiesImportedHashes(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key := pbkdf2.Key([]byte("correct horse"), salt, 1000, 20, sha1.New)
+
+	// Auth0 pads base64 and leaves the digest out for SHA-1.
+	hash := fmt.Sprintf("$pbkdf2$i=1000,l=20$%s$%s",
+		base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(key))
+
+	ok, err := NewPBKDF2().Verify(hash, "correct horse")
+
+	if err != nil || !ok {
+		t.Errorf("Verify = %v, %v, want true", ok, err)
+	}
+
+	if !NewPBKDF2().Outdated(hash) {
+		t.Error("hash with few iterations is not outdated")
+	}
+}
+
+func TestDecodePBKDF2(t *testing.T) {
+	salt := base64.RawStdEncoding.EncodeToString(make([]byte, saltLength))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, keyLength))
+
+	hash := func(digest string, params string, salt string, key string) string {
+		return fmt.Sprintf("$pbkdf2%s$%s$%s$%s", digest, params, salt, key)
+	}
+
+	tests := []struct {
+		name  string
+		hash  string
+		valid bool
+	}{
+		{"sha1", hash("", "i=1000", salt, key), true},
+		{"sha256", hash("-sha256", "i=600000,l=32", salt, key), true},
+		{"sha512", hash("-sha512", "i=210000,l=64", salt, key), true},
+		{"max iterations", hash("-sha256", "i=2000000", salt, key), true},
+		{"padded base64", hash("-sha256", "i=1000", base64.StdEncoding.EncodeToString(make([]byte, 17)), key), true},
+		{"empty", "", false},
+		{"missing part", "$pbkdf2-sha256$i=1000$" + salt, false},
+		{"unsupported digest", hash("-md5", "i=1000", salt, key), false},
+		{"malformed iterations", hash("-sha256", "i=many", salt, key), false},
+		{"missing iterations", hash("-sha256", "l=32", salt, key), false},
+		{"zero iterations", hash("-sha256", "i=0", salt, key), false},
+		{"negative iterations", hash("-sha256", "i=-1", salt, key), false},
+		{"huge iterations", hash("-sha256", "i=2000000000", salt, key), false},
+		{"malformed salt", hash("-sha256", "i=1000", "!!!", key), false},
+		{"malformed key", hash("-sha256", "i=1000", salt, "!!!"), false},
+		{"empty salt", hash("-sha256", "i=1000", "", key), false},
+		{"short salt", hash("-sha256", "i=1000", base64.RawStdEncoding.EncodeToString(make([]byte, 4)), key), false},
+		{"empty key", hash("-sha256", "i=1000", salt, ""), false},
+		{"short key", hash("-sha256", "i=1000", salt, base64.RawStdEncoding.EncodeToString(make([]byte, 4))), false},
+		{"long key", hash("-sha256", "i=1000", salt, base64.RawStdEncoding.EncodeToString(make([]byte, 1024))), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, _, _, err := decodePBKDF2(test.hash)
+
+			if (err == nil) != test.valid {
+				t.Errorf("decodePBKDF2(%q) error = %v, want valid %v", test.hash, err, test.valid)
+			}
+		})
+	}
+}
+
+func TestHasherCheck(t *testing.T) {
+	hasher := NewHasher(NewArgon2id(DefaultArgon2idParams()), NewBcrypt(10), NewPBKDF2())
+	salt := base64.RawStdEncoding.EncodeToString(make([]byte, saltLength))
+	key := base64.RawStdEncoding.EncodeToString(make([]byte, keyLength))
+
+	tests := []struct {
+		name  string
+		hash  string
+		valid bool
+	}{
+		{"argon2id", "$argon2id$v=19$m=65536,t=3,p=2$" + salt + "$" + key, true},
+		{"argon2id out of bounds", "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key, false},
+		{"pbkdf2", "$pbkdf2-sha256$i=1000$" + salt + "$" + key, true},
+		{"pbkdf2 out of bounds", "$pbkdf2-sha256$i=99999999$" + salt + "$" + key, false},
+		{"bcrypt", "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", true},
+		{"bcrypt cost out of bounds", "$2a$31$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy", false},
+		{"unsupported", "md5$abc", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := hasher.Check(test.hash)
+
+			if (err == nil) != test.valid {
+				t.Errorf("Check(%q) error = %v, want valid %v", test.hash, err, test.valid)
+			}
+		})
+	}
+}
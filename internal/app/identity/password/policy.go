@@ -0,0 +1,105 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	generator "github.com/sethvargo/go-password/password"
+)
+
+const (
+	defaultMinLength      = 8
+	maxGenerationAttempts = 100
+)
+
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinLength:        defaultMinLength,
+		DisallowUsername: true,
+	}
+}
+
+func (p *Policy) Validate(password string, username string) []Violation {
+	var violations []Violation
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:    RuleMinLength,
+			Message: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	var hasUppercase, hasLowercase, hasDigit, hasSymbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUppercase = true
+		case unicode.IsLower(r):
+			hasLowercase = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUppercase && !hasUppercase {
+		violations = append(violations, Violation{Rule: RuleRequireUppercase, Message: "must contain an uppercase letter"})
+	}
+
+	if p.RequireLowercase && !hasLowercase {
+		violations = append(violations, Violation{Rule: RuleRequireLowercase, Message: "must contain a lowercase letter"})
+	}
+
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, Violation{Rule: RuleRequireDigit, Message: "must contain a digit"})
+	}
+
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, Violation{Rule: RuleRequireSymbol, Message: "must contain a symbol"})
+	}
+
+	if p.DisallowUsername && len(username) != 0 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		violations = append(violations, Violation{Rule: RuleDisallowUsername, Message: "must not contain the username"})
+	}
+
+	return violations
+}
+
+func (p *Policy) Expired(changedAt time.Time) bool {
+	if p.MaxAgeDays <= 0 || changedAt.IsZero() {
+		return false
+	}
+
+	return time.Since(changedAt) > time.Duration(p.MaxAgeDays)*24*time.Hour
+}
+
+func (p *Policy) generatedLength() int {
+	if p.MinLength > 16 {
+		return p.MinLength
+	}
+
+	return 16
+}
+
+// Generate returns a random password that satisfies the policy for the
+// username.
+func (p *Policy) Generate(username string) (string, error) {
+	for i := 0; i < maxGenerationAttempts; i++ {
+		length := p.generatedLength()
+		pass, err := generator.Generate(length, 4, 2, false, length > 16)
+
+		if err != nil {
+			return "", err
+		}
+
+		if len(p.Validate(pass, username)) == 0 {
+			return pass, nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to generate a password satisfying the policy")
+}
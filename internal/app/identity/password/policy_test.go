@@ -0,0 +1,29 @@
+package password
+
+import "testing"
+
+func TestGenerateSatisfiesPolicyForUsername(t *testing.T) {
+	policy := &Policy{
+		MinLength:        12,
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowUsername: true,
+	}
+
+	// Short usernames are likely to turn up in a random password.
+	for _, username := range []string{"a", "x", "7", "ab", "alice"} {
+		for i := 0; i < 200; i++ {
+			pass, err := policy.Generate(username)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if violations := policy.Validate(pass, username); len(violations) != 0 {
+				t.Fatalf("generated password %q violates %v for username %q", pass, violations, username)
+			}
+		}
+	}
+}
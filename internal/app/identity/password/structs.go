@@ -0,0 +1,55 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Policy struct {
+	MinLength        int  `json:"min_length" bson:"min_length"`
+	RequireUppercase bool `json:"require_uppercase" bson:"require_uppercase"`
+	RequireLowercase bool `json:"require_lowercase" bson:"require_lowercase"`
+	RequireDigit     bool `json:"require_digit" bson:"require_digit"`
+	RequireSymbol    bool `json:"require_symbol" bson:"require_symbol"`
+	MaxAgeDays       int  `json:"max_age_days" bson:"max_age_days"`
+	DisallowUsername bool `json:"disallow_username" bson:"disallow_username"`
+	HistoryDepth     int  `json:"history_depth" bson:"history_depth"`
+}
+
+type Rule string
+
+const (
+	RuleMinLength        Rule = "MIN_LENGTH"
+	RuleRequireUppercase Rule = "REQUIRE_UPPERCASE"
+	RuleRequireLowercase Rule = "REQUIRE_LOWERCASE"
+	RuleRequireDigit     Rule = "REQUIRE_DIGIT"
+	RuleRequireSymbol    Rule = "REQUIRE_SYMBOL"
+	RuleDisallowUsername Rule = "DISALLOW_USERNAME"
+	RuleHistory          Rule = "HISTORY"
+	RuleBreached         Rule = "BREACHED"
+)
+
+type Violation struct {
+	Rule    Rule   `json:"rule"`
+	Message string `json:"message"`
+}
+
+type PolicyViolationError struct {
+	Violations []Violation
+}
+
+func (e *PolicyViolationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+
+	return fmt.Sprintf("password does not satisfy the policy: %s", strings.Join(messages, ", "))
+}
+
+type PolicyViolationResponse struct {
+	Success    bool        `json:"success"`
+	Message    string      `json:"message"`
+	Violations []Violation `json:"violations"`
+}
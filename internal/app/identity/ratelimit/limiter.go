@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superstackhq/common/api"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/pkg/actor"
+	"go.uber.org/zap"
+)
+
+type Limiter struct {
+	config        *Config
+	store         Store
+	authenticator *authentication.Authenticator
+}
+
+func NewLimiter(config *Config, store Store, authenticator *authentication.Authenticator) *Limiter {
+	return &Limiter{
+		config:        config,
+		store:         store,
+		authenticator: authenticator,
+	}
+}
+
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := l.match(c)
+
+		if rule == nil {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c, 1*time.Second)
+		defer cancel()
+
+		result, err := l.store.Take(ctx, l.key(c, ctx, rule), rule)
+
+		if err != nil {
+			zap.L().Warn("error while applying rate limit, allowing request", zap.String("rule", rule.Name), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+		c.Header("RateLimit-Policy", strconv.Itoa(rule.Requests)+";w="+strconv.Itoa(seconds(rule.Period))+";burst="+strconv.Itoa(rule.Burst))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(seconds(result.RetryAfter)))
+			api.ErrorMessage(c, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (l *Limiter) match(c *gin.Context) *Rule {
+	path := c.FullPath()
+
+	if len(path) == 0 {
+		path = c.Request.URL.Path
+	}
+
+	for i := range l.config.Rules {
+		rule := &l.config.Rules[i]
+
+		if !strings.HasPrefix(path, rule.PathPrefix) {
+			continue
+		}
+
+		if len(rule.Methods) != 0 && !contains(rule.Methods, c.Request.Method) {
+			continue
+		}
+
+		return rule
+	}
+
+	return nil
+}
+
+func (l *Limiter) key(c *gin.Context, ctx context.Context, rule *Rule) string {
+	switch rule.Key {
+	case KeyActor, KeyOrganization:
+		au, err := l.authenticator.Identify(c, ctx)
+
+		if err != nil {
+			break
+		}
+
+		if rule.Key == KeyOrganization && len(au.OrganizationID) != 0 {
+			return rule.Name + ":organization:" + au.OrganizationID
+		}
+
+		// API keys have no actor ID to tell them apart.
+		id := au.ActorID
+
+		if au.ActorType == actor.TypeApiKey {
+			id = au.KeyID
+		}
+
+		return rule.Name + ":actor:" + string(au.ActorType) + ":" + id
+	}
+
+	return rule.Name + ":ip:" + c.ClientIP()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
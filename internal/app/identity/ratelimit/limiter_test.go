@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+)
+
+// sessions accepts every session and counts how often it is asked.
+type sessions struct {
+	lookups int32
+}
+
+func (s *sessions) Active(ctx context.Context, sessionID string, userID string) (bool, error) {
+	atomic.AddInt32(&s.lookups, 1)
+	return true, nil
+}
+
+func newTestRouter(t *testing.T, rule Rule) (*gin.Engine, *authentication.Authenticator, *sessions) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	validator := &sessions{}
+	authenticator := authentication.NewAuthenticator("secret", validator)
+	limiter := NewLimiter(&Config{Enabled: true, Rules: []Rule{rule}}, NewMemoryStore(), authenticator)
+
+	router := gin.New()
+	router.Use(limiter.Middleware())
+	router.GET("/api/v1/things", func(c *gin.Context) {
+		if _, err := authenticator.ValidateContext(c, c); err != nil {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+
+		c.Status(http.StatusOK)
+	})
+
+	return router, authenticator, validator
+}
+
+func get(router *gin.Engine, authorization string) int {
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/things", nil)
+	request.Header.Set("Authorization", authorization)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	return recorder.Code
+}
+
+func TestApiKeysHaveTheirOwnBuckets(t *testing.T) {
+	router, _, _ := newTestRouter(t, Rule{Name: "api", PathPrefix: "/api", Key: KeyActor, Requests: 1, Period: time.Hour, Burst: 2})
+
+	for i := 0; i < 2; i++ {
+		if code := get(router, "ApiKey first"); code == http.StatusTooManyRequests {
+			t.Fatalf("request %d of the first key was limited", i)
+		}
+	}
+
+	if code := get(router, "ApiKey first"); code != http.StatusTooManyRequests {
+		t.Errorf("third request of the first key returned %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	if code := get(router, "ApiKey second"); code == http.StatusTooManyRequests {
+		t.Error("second key was limited by the requests of the first")
+	}
+}
+
+func TestActorIsIdentifiedOncePerRequest(t *testing.T) {
+	router, authenticator, validator := newTestRouter(t, Rule{Name: "api", PathPrefix: "/api", Key: KeyActor, Requests: 100, Period: time.Minute, Burst: 100})
+
+	token, err := authenticator.GenerateToken("user", "org", false, nil, "session", time.Now().Add(time.Hour))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := get(router, "Bearer "+token); code != http.StatusOK {
+		t.Fatalf("request returned %d", code)
+	}
+
+	if validator.lookups != 1 {
+		t.Errorf("session was looked up %d times, want once", validator.lookups)
+	}
+}
+
+func TestActorsShareNoBucket(t *testing.T) {
+	router, authenticator, _ := newTestRouter(t, Rule{Name: "api", PathPrefix: "/api", Key: KeyActor, Requests: 1, Period: time.Hour, Burst: 1})
+
+	for _, userID := range []string{"first", "second"} {
+		token, err := authenticator.GenerateToken(userID, "org", false, nil, "session", time.Now().Add(time.Hour))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code := get(router, "Bearer "+token); code != http.StatusOK {
+			t.Errorf("first request of %s returned %d", userID, code)
+		}
+
+		if code := get(router, "Bearer "+token); code != http.StatusTooManyRequests {
+			t.Errorf("second request of %s returned %d, want %d", userID, code, http.StatusTooManyRequests)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	sweepInterval = 1 * time.Minute
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	rule      *Rule
+}
+
+type MemoryStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, rule *Rule) (*Result, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), updatedAt: now, rule: rule}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.updatedAt).Seconds()*rule.rate())
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+
+	if allowed {
+		b.tokens--
+	}
+
+	return rule.result(b.tokens, allowed), nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+
+	for key, b := range s.buckets {
+		if now.Sub(b.updatedAt) > b.rule.duration(float64(b.rule.Burst)-b.tokens) {
+			delete(s.buckets, key)
+		}
+	}
+
+	s.lastSweep = now
+}
@@ -0,0 +1,92 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Bucket struct {
+	mgm.DefaultModel `bson:",inline"`
+	Key              string    `json:"key" bson:"key"`
+	Tokens           float64   `json:"tokens" bson:"tokens"`
+	Allowed          bool      `json:"allowed" bson:"allowed"`
+	ExpiresAt        time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+func (b *Bucket) CollectionName() string {
+	return "rate_limit_buckets"
+}
+
+type MongoStore struct {
+}
+
+func NewMongoStore() *MongoStore {
+	return &MongoStore{}
+}
+
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := mgm.Coll(&Bucket{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+
+	return err
+}
+
+// Take refills and consumes the bucket in a single pipeline update so that
+// replicas sharing the datastore never race on the token count.
+func (s *MongoStore) Take(ctx context.Context, key string, rule *Rule) (*Result, error) {
+	now := time.Now().UTC()
+	burst := float64(rule.Burst)
+
+	refilled := bson.M{"$min": bson.A{
+		burst,
+		bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", burst}},
+			bson.M{"$multiply": bson.A{
+				bson.M{"$divide": bson.A{
+					bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}},
+					1000,
+				}},
+				rule.rate(),
+			}},
+		}},
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled}}},
+		{{Key: "$set", Value: bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}}},
+		{{Key: "$set", Value: bson.M{
+			"tokens":     bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+			"created_at": bson.M{"$ifNull": bson.A{"$created_at", now}},
+			"updated_at": now,
+			"expires_at": now.Add(rule.duration(burst)),
+		}}},
+	}
+
+	b := &Bucket{}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	err := mgm.Coll(b).FindOneAndUpdate(ctx, bson.M{"key": key}, pipeline, opts).Decode(b)
+
+	if mongo.IsDuplicateKeyError(err) {
+		err = mgm.Coll(b).FindOneAndUpdate(ctx, bson.M{"key": key}, pipeline, opts).Decode(b)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return rule.result(b.Tokens, b.Allowed), nil
+}
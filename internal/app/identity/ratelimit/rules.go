@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type ruleSpec struct {
+	Name       string   `json:"name"`
+	PathPrefix string   `json:"path_prefix"`
+	Methods    []string `json:"methods"`
+	Key        KeyType  `json:"key"`
+	Requests   int      `json:"requests"`
+	Period     string   `json:"period"`
+	Burst      int      `json:"burst"`
+}
+
+// ParseRules reads rules from a JSON array such as
+// [{"name":"signup","path_prefix":"/api/v1/accounts/signup","key":"ip","requests":10,"period":"1h","burst":5}].
+// Rules are matched in order, so more specific prefixes must come first.
+func ParseRules(spec string) ([]Rule, error) {
+	var specs []ruleSpec
+
+	err := json.Unmarshal([]byte(spec), &specs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rules := make([]Rule, 0, len(specs))
+
+	for _, s := range specs {
+		period, err := time.ParseDuration(s.Period)
+
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", s.Name, err)
+		}
+
+		if s.Key != KeyIP && s.Key != KeyActor && s.Key != KeyOrganization {
+			return nil, fmt.Errorf("rule %s: unsupported key %s", s.Name, s.Key)
+		}
+
+		if s.Requests <= 0 || period <= 0 {
+			return nil, fmt.Errorf("rule %s: requests and period must be positive", s.Name)
+		}
+
+		if s.Burst <= 0 {
+			s.Burst = s.Requests
+		}
+
+		rules = append(rules, Rule{
+			Name:       s.Name,
+			PathPrefix: s.PathPrefix,
+			Methods:    s.Methods,
+			Key:        s.Key,
+			Requests:   s.Requests,
+			Period:     period,
+			Burst:      s.Burst,
+		})
+	}
+
+	return rules, nil
+}
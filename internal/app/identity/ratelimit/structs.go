@@ -0,0 +1,110 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+type KeyType string
+
+const (
+	KeyIP           KeyType = "ip"
+	KeyActor        KeyType = "actor"
+	KeyOrganization KeyType = "organization"
+)
+
+type StoreType string
+
+const (
+	StoreMemory StoreType = "memory"
+	StoreMongo  StoreType = "mongo"
+)
+
+type Rule struct {
+	Name       string
+	PathPrefix string
+	Methods    []string
+	Key        KeyType
+	Requests   int
+	Period     time.Duration
+	Burst      int
+}
+
+type Config struct {
+	Enabled bool
+	Store   StoreType
+	Rules   []Rule
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type Store interface {
+	Take(ctx context.Context, key string, rule *Rule) (*Result, error)
+}
+
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:       "signup",
+			PathPrefix: "/api/v1/accounts/signup",
+			Key:        KeyIP,
+			Requests:   10,
+			Period:     time.Hour,
+			Burst:      5,
+		},
+		{
+			Name:       "accounts",
+			PathPrefix: "/api/v1/accounts",
+			Key:        KeyIP,
+			Requests:   60,
+			Period:     time.Minute,
+			Burst:      20,
+		},
+		{
+			Name:       "users-list",
+			PathPrefix: "/api/v1/users",
+			Methods:    []string{"GET"},
+			Key:        KeyActor,
+			Requests:   120,
+			Period:     time.Minute,
+			Burst:      30,
+		},
+		{
+			Name:       "api",
+			PathPrefix: "/api",
+			Key:        KeyActor,
+			Requests:   600,
+			Period:     time.Minute,
+			Burst:      100,
+		},
+	}
+}
+
+func (r *Rule) rate() float64 {
+	return float64(r.Requests) / r.Period.Seconds()
+}
+
+func (r *Rule) result(tokens float64, allowed bool) *Result {
+	result := &Result{
+		Allowed:   allowed,
+		Limit:     r.Burst,
+		Remaining: int(tokens),
+		Reset:     r.duration(float64(r.Burst) - tokens),
+	}
+
+	if !allowed {
+		result.RetryAfter = r.duration(1 - tokens)
+	}
+
+	return result
+}
+
+func (r *Rule) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / r.rate() * float64(time.Second))
+}
@@ -1,15 +1,29 @@
 package identity
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/kamva/mgm/v3"
 	"github.com/superstackhq/common/logger"
 	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/breach"
+	"github.com/superstackhq/identity/internal/app/identity/erasure"
+	"github.com/superstackhq/identity/internal/app/identity/export"
 	"github.com/superstackhq/identity/internal/app/identity/health"
+	"github.com/superstackhq/identity/internal/app/identity/importer"
+	"github.com/superstackhq/identity/internal/app/identity/invitation"
+	"github.com/superstackhq/identity/internal/app/identity/mail"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
 	"github.com/superstackhq/identity/internal/app/identity/organization"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/ratelimit"
+	"github.com/superstackhq/identity/internal/app/identity/session"
+	"github.com/superstackhq/identity/internal/app/identity/throttle"
+	"github.com/superstackhq/identity/internal/app/identity/token"
 	"github.com/superstackhq/identity/internal/app/identity/user"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
@@ -20,11 +34,25 @@ const (
 )
 
 type Config struct {
-	Host          string
-	Port          string
-	MongoEndpoint string
-	MongoDatabase string
-	JwtSecretKey  string
+	Host                       string
+	Port                       string
+	TrustedProxies             []string
+	MongoEndpoint              string
+	MongoDatabase              string
+	JwtSecretKey               string
+	BreachedPasswordsRangePath string
+	BreachedPasswordsBloomPath string
+	PasswordHashAlgorithm      string
+	BcryptCost                 int
+	Argon2idParams             password.Argon2idParams
+	WebURL                     string
+	SMTP                       mail.SMTPConfig
+	LoginThrottle              throttle.Config
+	RateLimit                  ratelimit.Config
+	SessionDuration            time.Duration
+	InvitationValidity         time.Duration
+	UserRetention              time.Duration
+	UserPurgeInterval          time.Duration
 }
 
 type Server struct {
@@ -52,6 +80,14 @@ func (s *Server) Start() {
 
 	router := gin.Default()
 
+	// Client IPs key login throttling and rate limits, so forwarding headers
+	// are only believed when a trusted proxy sets them.
+	err = router.SetTrustedProxies(s.config.TrustedProxies)
+
+	if err != nil {
+		zap.L().Panic("invalid trusted proxies", zap.Error(err))
+	}
+
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"*"},
@@ -60,14 +96,98 @@ func (s *Server) Start() {
 		AllowCredentials: true,
 	}))
 
-	authenticator := authentication.NewAuthenticator(s.config.JwtSecretKey)
+	sessionManager := session.NewManager()
+	authenticator := authentication.NewAuthenticator(s.config.JwtSecretKey, sessionManager)
+
+	if s.config.RateLimit.Enabled {
+		router.Use(ratelimit.NewLimiter(&s.config.RateLimit, s.rateLimitStore(), authenticator).Middleware())
+	}
+
+	breachChecker := s.breachChecker()
+
+	membershipManager := membership.NewManager()
+	organizationManager := organization.NewManager(membershipManager)
+	tokenManager := token.NewManager()
+	throttleManager := throttle.NewManager(&s.config.LoginThrottle)
+	mailTransport := s.mailTransport()
+	passwordHasher := s.passwordHasher()
+	userManager := user.NewManager(organizationManager, membershipManager, authenticator, breachChecker, passwordHasher, tokenManager, throttleManager, sessionManager, mailTransport, &user.Config{
+		WebURL:          s.config.WebURL,
+		SessionDuration: s.config.SessionDuration,
+		Retention:       s.config.UserRetention,
+	})
+	invitationManager := invitation.NewManager(userManager, organizationManager, tokenManager, mailTransport, &invitation.Config{
+		WebURL:   s.config.WebURL,
+		Validity: s.config.InvitationValidity,
+	})
+	importManager := importer.NewManager(userManager, invitationManager, passwordHasher)
+	erasureManager := erasure.NewManager(userManager, membershipManager, organizationManager, sessionManager, tokenManager, invitationManager, importManager, &erasure.Config{
+		Retention:     s.config.UserRetention,
+		PurgeInterval: s.config.UserPurgeInterval,
+	})
+	exportManager := export.NewManager(userManager, membershipManager, sessionManager, tokenManager, invitationManager)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err = throttleManager.EnsureIndexes(ctx)
+
+	if err == nil {
+		err = sessionManager.EnsureIndexes(ctx)
+	}
+
+	if err == nil {
+		err = membershipManager.EnsureIndexes(ctx)
+	}
+
+	if err == nil {
+		err = organizationManager.MigrateSlugs(ctx)
+	}
+
+	if err == nil {
+		err = organizationManager.EnsureIndexes(ctx)
+	}
+
+	if err == nil {
+		err = userManager.MigrateMemberships(ctx)
+	}
+
+	if err == nil {
+		err = userManager.MigrateUsernames(ctx)
+	}
+
+	if err == nil {
+		err = organizationManager.MigrateOwners(ctx)
+	}
+
+	if err == nil {
+		err = userManager.EnsureIndexes(ctx)
+	}
+
+	// Interrupted jobs are failed first, since only one job may be running in
+	// an organization.
+	if err == nil {
+		err = importManager.FailInterrupted(ctx)
+	}
+
+	if err == nil {
+		err = importManager.EnsureIndexes(ctx)
+	}
+
+	if err != nil {
+		zap.L().Panic("error while creating datastore indexes", zap.Error(err))
+	}
 
-	organizationManager := organization.NewManager()
-	userManager := user.NewManager(organizationManager, authenticator)
+	go erasureManager.RunPurge(context.Background())
 
 	health.NewHandler(router).Register()
-	organization.NewHandler(router, authenticator, organizationManager).Register()
+	organization.NewHandler(router, authenticator, organizationManager, userManager).Register()
 	user.NewHandler(router, authenticator, userManager).Register()
+	session.NewHandler(router, authenticator, sessionManager).Register()
+	invitation.NewHandler(router, authenticator, invitationManager).Register()
+	erasure.NewHandler(router, authenticator, erasureManager).Register()
+	export.NewHandler(router, authenticator, exportManager).Register()
+	importer.NewHandler(router, authenticator, importManager).Register()
 
 	zap.L().Info("starting identity server", zap.String("host", s.config.Host), zap.String("port", s.config.Port))
 	err = router.Run(fmt.Sprintf("%s:%s", s.config.Host, s.config.Port))
@@ -76,3 +196,74 @@ func (s *Server) Start() {
 		zap.L().Panic("error while starting identity server", zap.Error(err))
 	}
 }
+
+func (s *Server) breachChecker() breach.Checker {
+	if len(s.config.BreachedPasswordsBloomPath) != 0 {
+		filter, err := breach.LoadBloomFilter(s.config.BreachedPasswordsBloomPath)
+
+		if err != nil {
+			zap.L().Panic("error while loading breached password bloom filter", zap.Error(err))
+		}
+
+		return filter
+	}
+
+	if len(s.config.BreachedPasswordsRangePath) != 0 {
+		checker, err := breach.NewRangeChecker(s.config.BreachedPasswordsRangePath)
+
+		if err != nil {
+			zap.L().Panic("error while loading breached password range dataset", zap.Error(err))
+		}
+
+		return checker
+	}
+
+	return breach.NewNopChecker()
+}
+
+func (s *Server) passwordHasher() *password.Hasher {
+	bcrypt := password.NewBcrypt(s.config.BcryptCost)
+	argon2id := password.NewArgon2id(s.config.Argon2idParams)
+	pbkdf2 := password.NewPBKDF2()
+
+	switch s.config.PasswordHashAlgorithm {
+	case "bcrypt":
+		return password.NewHasher(bcrypt, argon2id, pbkdf2)
+	case "", "argon2id":
+		return password.NewHasher(argon2id, bcrypt, pbkdf2)
+	default:
+		zap.L().Panic("unsupported password hash algorithm", zap.String("algorithm", s.config.PasswordHashAlgorithm))
+		return nil
+	}
+}
+
+func (s *Server) mailTransport() mail.Transport {
+	if len(s.config.SMTP.Host) == 0 {
+		return mail.NewLogTransport()
+	}
+
+	return mail.NewSMTPTransport(&s.config.SMTP)
+}
+
+func (s *Server) rateLimitStore() ratelimit.Store {
+	switch s.config.RateLimit.Store {
+	case ratelimit.StoreMongo:
+		store := ratelimit.NewMongoStore()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := store.EnsureIndexes(ctx)
+
+		if err != nil {
+			zap.L().Panic("error while creating rate limit indexes", zap.Error(err))
+		}
+
+		return store
+	case "", ratelimit.StoreMemory:
+		return ratelimit.NewMemoryStore()
+	default:
+		zap.L().Panic("unsupported rate limit store", zap.String("store", string(s.config.RateLimit.Store)))
+		return nil
+	}
+}
@@ -0,0 +1,256 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/superstackhq/common/api"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+	"github.com/superstackhq/identity/pkg/actor"
+)
+
+type Handler struct {
+	router        *gin.Engine
+	authenticator *authentication.Authenticator
+	manager       *Manager
+}
+
+func NewHandler(router *gin.Engine, authenticator *authentication.Authenticator, manager *Manager) *Handler {
+	return &Handler{
+		router:        router,
+		authenticator: authenticator,
+		manager:       manager,
+	}
+}
+
+func (h *Handler) Register() {
+	h.router.GET("/api/v1/users/me/sessions", h.listOwn)
+	h.router.DELETE("/api/v1/users/me/sessions/:sessionID", h.revokeOwn)
+	h.router.GET("/api/v1/users/me/logins", h.listOwnLogins)
+
+	h.router.GET("/api/v1/users/:userID/sessions", h.list)
+	h.router.DELETE("/api/v1/users/:userID/sessions/:sessionID", h.revoke)
+	h.router.GET("/api/v1/users/:userID/logins", h.listLogins)
+}
+
+func (h *Handler) listOwn(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 1*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	request, err := pagination.Parse(c)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.manager.List(ctx, a.ActorID, a.OrganizationID, a.SessionID, request)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	pagination.Respond(c, page)
+}
+
+func (h *Handler) revokeOwn(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	sessionID, ok := c.Params.Get("sessionID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "session id is required")
+		return
+	}
+
+	s, err := h.manager.Revoke(ctx, sessionID, a.ActorID, a.OrganizationID)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+func (h *Handler) listOwnLogins(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 1*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	request, err := pagination.Parse(c)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.manager.ListLogins(ctx, a.ActorID, a.OrganizationID, request)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	pagination.Respond(c, page)
+}
+
+func (h *Handler) list(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 1*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	request, err := pagination.Parse(c)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.manager.List(ctx, userID, a.OrganizationID, a.SessionID, request)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	pagination.Respond(c, page)
+}
+
+func (h *Handler) revoke(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	sessionID, ok := c.Params.Get("sessionID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "session id is required")
+		return
+	}
+
+	s, err := h.manager.Revoke(ctx, sessionID, userID, a.OrganizationID)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, s)
+}
+
+func (h *Handler) listLogins(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 1*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	request, err := pagination.Parse(c)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.manager.ListLogins(ctx, userID, a.OrganizationID, request)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	pagination.Respond(c, page)
+}
@@ -0,0 +1,315 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/kamva/mgm/v3/field"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Manager struct {
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+func (m *Manager) EnsureIndexes(ctx context.Context) error {
+	_, err := mgm.Coll(&Session{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "expires_at", Value: -1}}},
+		{Keys: bson.D{{Key: "organization_id", Value: 1}}},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = mgm.Coll(&LoginEvent{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "organization_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+
+	return err
+}
+
+func (m *Manager) Create(ctx context.Context, userID string, organizationID string, method Method, client *Client, restricted bool, validity time.Duration) (*Session, error) {
+	s := &Session{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Method:         method,
+		IP:             client.IP,
+		UserAgent:      client.UserAgent,
+		Restricted:     restricted,
+		ExpiresAt:      time.Now().UTC().Add(validity),
+	}
+
+	err := mgm.Coll(s).CreateWithCtx(ctx, s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *Manager) Active(ctx context.Context, sessionID string, userID string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+
+	if err != nil {
+		return false, nil
+	}
+
+	count, err := mgm.Coll(&Session{}).CountDocuments(ctx, m.activeFilter(bson.M{
+		field.ID:  id,
+		"user_id": userID,
+	}))
+
+	if err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
+func (m *Manager) List(ctx context.Context, userID string, organizationID string, currentSessionID string, request *pagination.Request) (*pagination.Page, error) {
+	coll := mgm.Coll(&Session{})
+	filter := m.activeFilter(bson.M{
+		"user_id":         userID,
+		"organization_id": organizationID,
+	})
+
+	total, err := coll.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*Session{}
+
+	err = coll.SimpleFindWithCtx(ctx, &sessions, request.Filter(filter, "_id", true), request.Options("_id", true))
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &pagination.Page{Total: total, HasMore: request.More(len(sessions))}
+
+	if page.HasMore {
+		sessions = sessions[:request.Size]
+
+		page.NextCursor, err = pagination.Next(sessions[len(sessions)-1].ID, nil)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range sessions {
+		s.Current = s.ID.Hex() == currentSessionID
+	}
+
+	page.Items = sessions
+
+	return page, nil
+}
+
+func (m *Manager) Revoke(ctx context.Context, sessionID string, userID string, organizationID string) (*Session, error) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+
+	err = mgm.Coll(s).FirstWithCtx(ctx, m.activeFilter(bson.M{
+		field.ID:          id,
+		"user_id":         userID,
+		"organization_id": organizationID,
+	}), s)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("session not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	s.RevokedAt = &now
+
+	err = mgm.Coll(s).UpdateWithCtx(ctx, s)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *Manager) RevokeAll(ctx context.Context, userID string) error {
+	now := time.Now().UTC()
+
+	_, err := mgm.Coll(&Session{}).UpdateMany(ctx, m.activeFilter(bson.M{
+		"user_id": userID,
+	}), bson.M{
+		"$set": bson.M{"revoked_at": now, "updated_at": now},
+	})
+
+	return err
+}
+
+// RevokeOthers revokes every session of the user except the current one.
+func (m *Manager) RevokeOthers(ctx context.Context, userID string, currentSessionID string) error {
+	filter := bson.M{"user_id": userID}
+
+	if id, err := primitive.ObjectIDFromHex(currentSessionID); err == nil {
+		filter[field.ID] = bson.M{"$ne": id}
+	}
+
+	now := time.Now().UTC()
+
+	_, err := mgm.Coll(&Session{}).UpdateMany(ctx, m.activeFilter(filter), bson.M{
+		"$set": bson.M{"revoked_at": now, "updated_at": now},
+	})
+
+	return err
+}
+
+func (m *Manager) RevokeOrganization(ctx context.Context, userID string, organizationID string) error {
+	now := time.Now().UTC()
+
+	_, err := mgm.Coll(&Session{}).UpdateMany(ctx, m.activeFilter(bson.M{
+		"user_id":         userID,
+		"organization_id": organizationID,
+	}), bson.M{
+		"$set": bson.M{"revoked_at": now, "updated_at": now},
+	})
+
+	return err
+}
+
+// RevokeAllInOrganization revokes the sessions of every user of the
+// organization.
+func (m *Manager) RevokeAllInOrganization(ctx context.Context, organizationID string) error {
+	now := time.Now().UTC()
+
+	_, err := mgm.Coll(&Session{}).UpdateMany(ctx, m.activeFilter(bson.M{
+		"organization_id": organizationID,
+	}), bson.M{
+		"$set": bson.M{"revoked_at": now, "updated_at": now},
+	})
+
+	return err
+}
+
+func (m *Manager) RecordLogin(ctx context.Context, event *LoginEvent) error {
+	return mgm.Coll(event).CreateWithCtx(ctx, event)
+}
+
+func (m *Manager) ListLogins(ctx context.Context, userID string, organizationID string, request *pagination.Request) (*pagination.Page, error) {
+	coll := mgm.Coll(&LoginEvent{})
+	filter := bson.M{
+		"user_id":         userID,
+		"organization_id": organizationID,
+	}
+
+	total, err := coll.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*LoginEvent{}
+
+	err = coll.SimpleFindWithCtx(ctx, &events, request.Filter(filter, "_id", true), request.Options("_id", true))
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &pagination.Page{Total: total, HasMore: request.More(len(events))}
+
+	if page.HasMore {
+		events = events[:request.Size]
+
+		page.NextCursor, err = pagination.Next(events[len(events)-1].ID, nil)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	page.Items = events
+
+	return page, nil
+}
+
+func (m *Manager) activeFilter(filter bson.M) bson.M {
+	filter["revoked_at"] = nil
+	filter["expires_at"] = bson.M{"$gt": time.Now().UTC()}
+	return filter
+}
+
+// Erase deletes the sessions and login history of the user.
+func (m *Manager) Erase(ctx context.Context, userID string) error {
+	_, err := mgm.Coll(&Session{}).DeleteMany(ctx, bson.M{
+		"user_id": userID,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = mgm.Coll(&LoginEvent{}).DeleteMany(ctx, bson.M{
+		"user_id": userID,
+	})
+
+	return err
+}
+
+// ListAll returns every session of the user in the organization, or across
+// organizations if it is empty, including expired and revoked ones.
+func (m *Manager) ListAll(ctx context.Context, userID string, organizationID string) ([]*Session, error) {
+	sessions := []*Session{}
+
+	err := mgm.Coll(&Session{}).SimpleFindWithCtx(ctx, &sessions, userFilter(userID, organizationID), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// ListAllLogins returns the login history of the user in the organization,
+// or across organizations if it is empty.
+func (m *Manager) ListAllLogins(ctx context.Context, userID string, organizationID string) ([]*LoginEvent, error) {
+	events := []*LoginEvent{}
+
+	err := mgm.Coll(&LoginEvent{}).SimpleFindWithCtx(ctx, &events, userFilter(userID, organizationID), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func userFilter(userID string, organizationID string) bson.M {
+	filter := bson.M{"user_id": userID}
+
+	if len(organizationID) != 0 {
+		filter["organization_id"] = organizationID
+	}
+
+	return filter
+}
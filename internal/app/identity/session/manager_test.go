@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/superstackhq/identity/internal/app/identity/testdb"
+)
+
+var testClient = &Client{IP: "192.0.2.1", UserAgent: "test"}
+
+func create(ctx context.Context, t *testing.T, m *Manager, userID string, organizationID string) *Session {
+	t.Helper()
+
+	s, err := m.Create(ctx, userID, organizationID, MethodPassword, testClient, false, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// assertActive checks which of the sessions are still active.
+func assertActive(ctx context.Context, t *testing.T, m *Manager, want map[*Session]bool) {
+	t.Helper()
+
+	for s, active := range want {
+		got, err := m.Active(ctx, s.ID.Hex(), s.UserID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != active {
+			t.Errorf("session of %s in %s active = %v, want %v", s.UserID, s.OrganizationID, got, active)
+		}
+	}
+}
+
+func TestRevokeOthersKeepsTheCurrentSession(t *testing.T) {
+	ctx := testdb.Setup(t)
+	m := NewManager()
+
+	current := create(ctx, t, m, "alice", "org-a")
+	other := create(ctx, t, m, "alice", "org-a")
+	elsewhere := create(ctx, t, m, "alice", "org-b")
+	stranger := create(ctx, t, m, "bob", "org-a")
+
+	if err := m.RevokeOthers(ctx, "alice", current.ID.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertActive(ctx, t, m, map[*Session]bool{current: true, other: false, elsewhere: false, stranger: true})
+}
+
+func TestRevokeIsScopedToUserAndOrganization(t *testing.T) {
+	ctx := testdb.Setup(t)
+	m := NewManager()
+
+	s := create(ctx, t, m, "alice", "org-a")
+
+	if _, err := m.Revoke(ctx, s.ID.Hex(), "bob", "org-a"); err == nil {
+		t.Error("another user revoked the session")
+	}
+
+	if _, err := m.Revoke(ctx, s.ID.Hex(), "alice", "org-b"); err == nil {
+		t.Error("session was revoked from another organization")
+	}
+
+	assertActive(ctx, t, m, map[*Session]bool{s: true})
+
+	if _, err := m.Revoke(ctx, s.ID.Hex(), "alice", "org-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertActive(ctx, t, m, map[*Session]bool{s: false})
+
+	if _, err := m.Revoke(ctx, s.ID.Hex(), "alice", "org-a"); err == nil {
+		t.Error("revoked session was revoked again")
+	}
+}
+
+func TestRevokeOrganizationLeavesOtherOrganizations(t *testing.T) {
+	ctx := testdb.Setup(t)
+	m := NewManager()
+
+	first := create(ctx, t, m, "alice", "org-a")
+	second := create(ctx, t, m, "alice", "org-b")
+	colleague := create(ctx, t, m, "bob", "org-a")
+
+	if err := m.RevokeOrganization(ctx, "alice", "org-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertActive(ctx, t, m, map[*Session]bool{first: false, second: true, colleague: true})
+
+	if err := m.RevokeAllInOrganization(ctx, "org-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertActive(ctx, t, m, map[*Session]bool{second: true, colleague: false})
+}
+
+func TestExpiredSessionIsInactive(t *testing.T) {
+	ctx := testdb.Setup(t)
+	m := NewManager()
+
+	s, err := m.Create(ctx, "alice", "org-a", MethodPassword, testClient, false, -time.Minute)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertActive(ctx, t, m, map[*Session]bool{s: false})
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+	"time"
+
+	"github.com/kamva/mgm/v3"
+)
+
+type Method string
+
+const (
+	MethodPassword           Method = "PASSWORD"
+	MethodOrganizationSwitch Method = "ORGANIZATION_SWITCH"
+)
+
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+type Session struct {
+	mgm.DefaultModel `bson:",inline"`
+	UserID           string     `json:"user_id" bson:"user_id"`
+	OrganizationID   string     `json:"organization_id" bson:"organization_id"`
+	Method           Method     `json:"method" bson:"method"`
+	IP               string     `json:"ip" bson:"ip"`
+	UserAgent        string     `json:"user_agent" bson:"user_agent"`
+	Restricted       bool       `json:"restricted" bson:"restricted"`
+	ExpiresAt        time.Time  `json:"expires_at" bson:"expires_at"`
+	RevokedAt        *time.Time `json:"revoked_at" bson:"revoked_at"`
+	Current          bool       `json:"current" bson:"-"`
+}
+
+type LoginEvent struct {
+	mgm.DefaultModel `bson:",inline"`
+	UserID           string `json:"user_id" bson:"user_id"`
+	OrganizationID   string `json:"organization_id" bson:"organization_id"`
+	Username         string `json:"username" bson:"username"`
+	Method           Method `json:"method" bson:"method"`
+	Success          bool   `json:"success" bson:"success"`
+	FailureReason    string `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	IP               string `json:"ip" bson:"ip"`
+	UserAgent        string `json:"user_agent" bson:"user_agent"`
+	SessionID        string `json:"session_id,omitempty" bson:"session_id,omitempty"`
+}
@@ -0,0 +1,58 @@
+// Package testdb gives tests that exercise the managers against a datastore
+// a database of their own. The tests are skipped unless
+// IDENTITY_TEST_MONGO_ENDPOINT points at a MongoDB server.
+package testdb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const endpointVariable = "IDENTITY_TEST_MONGO_ENDPOINT"
+
+// Setup connects mgm to a new database, which is dropped when the test ends.
+// Tests using it must not run in parallel, since mgm has a single default
+// connection.
+func Setup(t *testing.T) context.Context {
+	t.Helper()
+
+	endpoint := os.Getenv(endpointVariable)
+
+	if len(endpoint) == 0 {
+		t.Skipf("%s is not set", endpointVariable)
+	}
+
+	err := mgm.SetDefaultConfig(nil, "identity_test_"+primitive.NewObjectID().Hex(), options.Client().ApplyURI(endpoint))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	t.Cleanup(func() {
+		defer cancel()
+
+		_, client, db, err := mgm.DefaultConfigs()
+
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if err = db.Drop(ctx); err != nil {
+			t.Error(err)
+		}
+
+		_ = client.Disconnect(ctx)
+		mgm.ResetDefaultConfig()
+	})
+
+	return ctx
+}
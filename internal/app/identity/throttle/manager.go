@@ -0,0 +1,170 @@
+package throttle
+
+import (
+	"context"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// delayFreeFailures is the number of failures tolerated before
+	// progressive delays between attempts kick in.
+	delayFreeFailures = 3
+)
+
+type Manager struct {
+	config *Config
+}
+
+func NewManager(config *Config) *Manager {
+	return &Manager{
+		config: config,
+	}
+}
+
+func (m *Manager) EnsureIndexes(ctx context.Context) error {
+	_, err := mgm.Coll(&FailedAttempts{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "last_failure_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(m.retention().Seconds())),
+		},
+	})
+
+	return err
+}
+
+func (m *Manager) Check(ctx context.Context, userKey string, ip string) error {
+	err := m.check(ctx, KindUser, userKey, m.config.UserMaxFailures)
+
+	if err != nil {
+		return err
+	}
+
+	return m.check(ctx, KindIP, ip, m.config.IPMaxFailures)
+}
+
+func (m *Manager) RecordFailure(ctx context.Context, userKey string, ip string) error {
+	err := m.recordFailure(ctx, KindUser, userKey)
+
+	if err != nil {
+		return err
+	}
+
+	return m.recordFailure(ctx, KindIP, ip)
+}
+
+func (m *Manager) RecordSuccess(ctx context.Context, userKey string) error {
+	return m.Reset(ctx, userKey)
+}
+
+func (m *Manager) Reset(ctx context.Context, userKey string) error {
+	_, err := mgm.Coll(&FailedAttempts{}).DeleteOne(ctx, bson.M{
+		"kind": KindUser,
+		"key":  userKey,
+	})
+
+	return err
+}
+
+func (m *Manager) check(ctx context.Context, kind Kind, key string, maxFailures int) error {
+	attempts := &FailedAttempts{}
+
+	err := mgm.Coll(attempts).FirstWithCtx(ctx, bson.M{
+		"kind": kind,
+		"key":  key,
+	}, attempts)
+
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	if now.Sub(attempts.LastFailureAt) > m.config.FailureWindow && attempts.Failures < maxFailures {
+		return nil
+	}
+
+	if attempts.Failures >= maxFailures {
+		lockedUntil := attempts.LastFailureAt.Add(m.config.LockoutDuration)
+
+		if now.Before(lockedUntil) {
+			return &ThrottledError{RetryAfter: lockedUntil.Sub(now), Locked: true}
+		}
+
+		return nil
+	}
+
+	allowedAt := attempts.LastFailureAt.Add(m.delay(attempts.Failures))
+
+	if now.Before(allowedAt) {
+		return &ThrottledError{RetryAfter: allowedAt.Sub(now)}
+	}
+
+	return nil
+}
+
+func (m *Manager) recordFailure(ctx context.Context, kind Kind, key string) error {
+	now := time.Now().UTC()
+	coll := mgm.Coll(&FailedAttempts{})
+
+	result, err := coll.UpdateOne(ctx, bson.M{
+		"kind":            kind,
+		"key":             key,
+		"last_failure_at": bson.M{"$gte": now.Add(-m.config.FailureWindow)},
+	}, bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure_at": now, "updated_at": now},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount != 0 {
+		return nil
+	}
+
+	_, err = coll.UpdateOne(ctx, bson.M{
+		"kind": kind,
+		"key":  key,
+	}, bson.M{
+		"$set":         bson.M{"failures": 1, "last_failure_at": now, "updated_at": now},
+		"$setOnInsert": bson.M{"created_at": now},
+	}, options.Update().SetUpsert(true))
+
+	return err
+}
+
+func (m *Manager) delay(failures int) time.Duration {
+	if failures < delayFreeFailures {
+		return 0
+	}
+
+	delay := m.config.BaseDelay << (failures - delayFreeFailures)
+
+	if delay <= 0 || delay > m.config.MaxDelay {
+		return m.config.MaxDelay
+	}
+
+	return delay
+}
+
+func (m *Manager) retention() time.Duration {
+	if m.config.LockoutDuration > m.config.FailureWindow {
+		return m.config.LockoutDuration
+	}
+
+	return m.config.FailureWindow
+}
@@ -0,0 +1,121 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/internal/app/identity/testdb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDelayGrowsUpToTheMaximum(t *testing.T) {
+	m := NewManager(&Config{BaseDelay: time.Second, MaxDelay: 10 * time.Second})
+
+	tests := map[int]time.Duration{
+		0:   0,
+		2:   0,
+		3:   time.Second,
+		4:   2 * time.Second,
+		6:   8 * time.Second,
+		7:   10 * time.Second,
+		100: 10 * time.Second,
+	}
+
+	for failures, want := range tests {
+		if got := m.delay(failures); got != want {
+			t.Errorf("delay(%d) = %s, want %s", failures, got, want)
+		}
+	}
+}
+
+func newTestManager(t *testing.T, config *Config) (context.Context, *Manager) {
+	t.Helper()
+
+	ctx := testdb.Setup(t)
+	m := NewManager(config)
+
+	if err := m.EnsureIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	return ctx, m
+}
+
+func TestLockoutAfterMaxFailures(t *testing.T) {
+	ctx, m := newTestManager(t, &Config{UserMaxFailures: 2, IPMaxFailures: 100, FailureWindow: time.Hour, LockoutDuration: time.Hour})
+
+	for i := 0; i < 2; i++ {
+		if err := m.Check(ctx, "org/alice", "192.0.2.1"); err != nil {
+			t.Fatalf("attempt %d was throttled: %v", i, err)
+		}
+
+		if err := m.RecordFailure(ctx, "org/alice", "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var throttled *ThrottledError
+
+	if err := m.Check(ctx, "org/alice", "192.0.2.2"); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("Check after lockout returned %v, want a lockout from any address", err)
+	}
+
+	if err := m.Check(ctx, "org/bob", "192.0.2.1"); err != nil {
+		t.Errorf("lockout of one user throttled another: %v", err)
+	}
+
+	if err := m.Reset(ctx, "org/alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Check(ctx, "org/alice", "192.0.2.1"); err != nil {
+		t.Errorf("Check after reset returned %v", err)
+	}
+}
+
+func TestAddressLockoutCoversEveryUser(t *testing.T) {
+	ctx, m := newTestManager(t, &Config{UserMaxFailures: 100, IPMaxFailures: 3, FailureWindow: time.Hour, LockoutDuration: time.Hour})
+
+	for _, key := range []string{"org/a", "org/b", "org/c"} {
+		if err := m.RecordFailure(ctx, key, "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var throttled *ThrottledError
+
+	if err := m.Check(ctx, "org/d", "192.0.2.1"); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Errorf("Check from a locked address returned %v, want a lockout", err)
+	}
+
+	if err := m.Check(ctx, "org/d", "192.0.2.2"); err != nil {
+		t.Errorf("Check from another address returned %v", err)
+	}
+}
+
+func TestFailuresOutsideTheWindowStartOver(t *testing.T) {
+	ctx, m := newTestManager(t, &Config{UserMaxFailures: 2, IPMaxFailures: 100, FailureWindow: time.Minute, LockoutDuration: time.Hour})
+
+	if err := m.RecordFailure(ctx, "org/alice", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := mgm.Coll(&FailedAttempts{}).UpdateMany(ctx, bson.M{}, bson.M{
+		"$set": bson.M{"last_failure_at": time.Now().UTC().Add(-2 * time.Minute)},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.RecordFailure(ctx, "org/alice", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Check(ctx, "org/alice", "192.0.2.1"); err != nil {
+		t.Errorf("failures from separate windows locked the account: %v", err)
+	}
+}
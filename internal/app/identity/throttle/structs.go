@@ -0,0 +1,45 @@
+package throttle
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+)
+
+type Kind string
+
+const (
+	KindUser Kind = "USER"
+	KindIP   Kind = "IP"
+)
+
+type Config struct {
+	UserMaxFailures int
+	IPMaxFailures   int
+	FailureWindow   time.Duration
+	LockoutDuration time.Duration
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+}
+
+type FailedAttempts struct {
+	mgm.DefaultModel `bson:",inline"`
+	Kind             Kind      `json:"kind" bson:"kind"`
+	Key              string    `json:"key" bson:"key"`
+	Failures         int       `json:"failures" bson:"failures"`
+	LastFailureAt    time.Time `json:"last_failure_at" bson:"last_failure_at"`
+}
+
+type ThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *ThrottledError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed attempts, account is locked for %s", e.RetryAfter.Round(time.Second))
+	}
+
+	return fmt.Sprintf("too many failed attempts, retry in %s", e.RetryAfter.Round(time.Second))
+}
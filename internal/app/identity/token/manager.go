@@ -0,0 +1,176 @@
+package token
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	tokenLength = 32
+)
+
+var ErrInvalid = errors.New("invalid or expired token")
+
+type Manager struct {
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+func (m *Manager) Issue(ctx context.Context, purpose Purpose, userID string, organizationID string, validity time.Duration) (string, error) {
+	err := m.Invalidate(ctx, purpose, userID, organizationID)
+
+	if err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, tokenLength)
+
+	if _, err = rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	plaintext := base64.RawURLEncoding.EncodeToString(raw)
+
+	t := &Token{
+		Purpose:        purpose,
+		Hash:           hash(plaintext),
+		UserID:         userID,
+		OrganizationID: organizationID,
+		ExpiresAt:      time.Now().UTC().Add(validity),
+	}
+
+	err = mgm.Coll(t).CreateWithCtx(ctx, t)
+
+	if err != nil {
+		return "", err
+	}
+
+	return plaintext, nil
+}
+
+// Invalidate deletes the unused tokens issued to the user for the purpose in
+// the organization, leaving those of other organizations alone. Tokens that
+// are not issued for an organization have an empty organization ID.
+func (m *Manager) Invalidate(ctx context.Context, purpose Purpose, userID string, organizationID string) error {
+	_, err := mgm.Coll(&Token{}).DeleteMany(ctx, bson.M{
+		"purpose":         purpose,
+		"user_id":         userID,
+		"organization_id": organizationID,
+		"used_at":         nil,
+	})
+
+	return err
+}
+
+// InvalidateAll deletes the unused tokens issued to the user for the purpose
+// in every organization.
+func (m *Manager) InvalidateAll(ctx context.Context, purpose Purpose, userID string) error {
+	_, err := mgm.Coll(&Token{}).DeleteMany(ctx, bson.M{
+		"purpose": purpose,
+		"user_id": userID,
+		"used_at": nil,
+	})
+
+	return err
+}
+
+// InvalidateOrganization deletes every unused token issued for the
+// organization.
+func (m *Manager) InvalidateOrganization(ctx context.Context, organizationID string) error {
+	_, err := mgm.Coll(&Token{}).DeleteMany(ctx, bson.M{
+		"organization_id": organizationID,
+		"used_at":         nil,
+	})
+
+	return err
+}
+
+func (m *Manager) Find(ctx context.Context, purpose Purpose, plaintext string) (*Token, error) {
+	t := &Token{}
+
+	err := mgm.Coll(t).FirstWithCtx(ctx, bson.M{
+		"purpose":    purpose,
+		"hash":       hash(plaintext),
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": time.Now().UTC()},
+	}, t)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalid
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (m *Manager) Consume(ctx context.Context, purpose Purpose, plaintext string) (*Token, error) {
+	now := time.Now().UTC()
+	t := &Token{}
+
+	err := mgm.Coll(t).FindOneAndUpdate(ctx, bson.M{
+		"purpose":    purpose,
+		"hash":       hash(plaintext),
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": now},
+	}, bson.M{
+		"$set": bson.M{"used_at": now},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(t)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalid
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func hash(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// Erase deletes every token issued to the user, used or not.
+func (m *Manager) Erase(ctx context.Context, userID string) error {
+	_, err := mgm.Coll(&Token{}).DeleteMany(ctx, bson.M{
+		"user_id": userID,
+	})
+
+	return err
+}
+
+// ListByUser returns the tokens of the user in the organization, or all of
+// them if it is empty.
+func (m *Manager) ListByUser(ctx context.Context, userID string, organizationID string) ([]*Token, error) {
+	tokens := []*Token{}
+	filter := bson.M{"user_id": userID}
+
+	if len(organizationID) != 0 {
+		filter["organization_id"] = organizationID
+	}
+
+	err := mgm.Coll(&Token{}).SimpleFindWithCtx(ctx, &tokens, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
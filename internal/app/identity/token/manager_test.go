@@ -0,0 +1,100 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/superstackhq/identity/internal/app/identity/testdb"
+)
+
+func TestIssueKeepsTokensOfOtherOrganizations(t *testing.T) {
+	ctx := testdb.Setup(t)
+	m := NewManager()
+
+	first, err := m.Issue(ctx, PurposeInvitation, "user", "org-a", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := m.Issue(ctx, PurposeInvitation, "user", "org-b", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for plaintext, organizationID := range map[string]string{first: "org-a", second: "org-b"} {
+		found, err := m.Find(ctx, PurposeInvitation, plaintext)
+
+		if err != nil {
+			t.Fatalf("token of %s: %v", organizationID, err)
+		}
+
+		if found.OrganizationID != organizationID {
+			t.Errorf("token belongs to %s, want %s", found.OrganizationID, organizationID)
+		}
+	}
+
+	reissued, err := m.Issue(ctx, PurposeInvitation, "user", "org-a", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Find(ctx, PurposeInvitation, first); err != ErrInvalid {
+		t.Errorf("replaced token of org-a returned %v, want ErrInvalid", err)
+	}
+
+	for _, plaintext := range []string{reissued, second} {
+		if _, err = m.Find(ctx, PurposeInvitation, plaintext); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestInvalidateIsScopedToTheOrganization(t *testing.T) {
+	ctx := testdb.Setup(t)
+	m := NewManager()
+
+	first, err := m.Issue(ctx, PurposeOrganizationRestore, "user", "org-a", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := m.Issue(ctx, PurposeOrganizationRestore, "user", "org-b", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verification, err := m.Issue(ctx, PurposeEmailVerification, "user", "", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = m.Invalidate(ctx, PurposeOrganizationRestore, "user", "org-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Find(ctx, PurposeOrganizationRestore, first); err != ErrInvalid {
+		t.Errorf("invalidated token returned %v, want ErrInvalid", err)
+	}
+
+	if _, err = m.Find(ctx, PurposeOrganizationRestore, second); err != nil {
+		t.Errorf("token of org-b: %v", err)
+	}
+
+	if _, err = m.Find(ctx, PurposeEmailVerification, verification); err != nil {
+		t.Errorf("token of another purpose: %v", err)
+	}
+
+	if err = m.Invalidate(ctx, PurposeEmailVerification, "user", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = m.Find(ctx, PurposeEmailVerification, verification); err != ErrInvalid {
+		t.Errorf("invalidated verification token returned %v, want ErrInvalid", err)
+	}
+}
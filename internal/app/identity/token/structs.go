@@ -0,0 +1,26 @@
+package token
+
+import (
+	"time"
+
+	"github.com/kamva/mgm/v3"
+)
+
+type Purpose string
+
+const (
+	PurposePasswordReset       Purpose = "PASSWORD_RESET"
+	PurposeInvitation          Purpose = "INVITATION"
+	PurposeEmailVerification   Purpose = "EMAIL_VERIFICATION"
+	PurposeOrganizationRestore Purpose = "ORGANIZATION_RESTORE"
+)
+
+type Token struct {
+	mgm.DefaultModel `bson:",inline"`
+	Purpose          Purpose    `json:"purpose" bson:"purpose"`
+	Hash             string     `json:"-" bson:"hash"`
+	UserID           string     `json:"user_id" bson:"user_id"`
+	OrganizationID   string     `json:"organization_id" bson:"organization_id"`
+	ExpiresAt        time.Time  `json:"expires_at" bson:"expires_at"`
+	UsedAt           *time.Time `json:"used_at" bson:"used_at"`
+}
@@ -2,14 +2,24 @@ package user
 
 import (
 	"context"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/superstackhq/common/api"
+	"github.com/superstackhq/identity/internal/app/identity/attribute"
 	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/session"
+	"github.com/superstackhq/identity/internal/app/identity/throttle"
+	"github.com/superstackhq/identity/internal/app/identity/token"
 	"github.com/superstackhq/identity/pkg/actor"
 	"github.com/superstackhq/identity/pkg/user"
+	"go.uber.org/zap"
 )
 
 type Handler struct {
@@ -29,16 +39,31 @@ func NewHandler(router *gin.Engine, authenticator *authentication.Authenticator,
 func (h *Handler) Register() {
 	h.router.POST("/api/v1/accounts/signup", h.signUp)
 	h.router.POST("/api/v1/accounts/authenticate", h.authenticate)
+	h.router.POST("/api/v1/accounts/password/forgot", h.forgotPassword)
+	h.router.POST("/api/v1/accounts/password/reset", h.confirmPasswordReset)
+
+	h.router.POST("/api/v1/accounts/email/verify", h.verifyEmail)
 
 	h.router.GET("/api/v1/users/me", h.get)
+	h.router.PATCH("/api/v1/users/me", h.updateProfile)
+	h.router.POST("/api/v1/users/me/email/verification", h.resendEmailVerification)
 	h.router.PUT("/api/v1/users/me/password", h.changePassword)
+	h.router.PUT("/api/v1/users/me/username", h.renameSelf)
+	h.router.GET("/api/v1/users/me/organizations", h.organizations)
+	h.router.POST("/api/v1/users/me/organizations/:organizationID/token", h.switchOrganization)
 
-	h.router.POST("/api/v1/users", h.add)
 	h.router.DELETE("/api/v1/users/:userID", h.delete)
 	h.router.GET("/api/v1/users", h.list)
+	h.router.GET("/api/v1/users/username-changes", h.usernameChanges)
 	h.router.GET("/api/v1/users/:userID", h.getByOrganization)
 	h.router.PUT("/api/v1/users/:userID/admin", h.changeAdmin)
+	h.router.PUT("/api/v1/users/:userID/username", h.rename)
+	h.router.PATCH("/api/v1/users/:userID/metadata", h.updateMetadata)
 	h.router.PUT("/api/v1/users/:userID/password", h.resetPassword)
+	h.router.POST("/api/v1/users/:userID/unlock", h.unlock)
+	h.router.POST("/api/v1/users/:userID/suspend", h.suspend)
+	h.router.POST("/api/v1/users/:userID/reactivate", h.reactivate)
+	h.router.POST("/api/v1/users/:userID/restore", h.restore)
 }
 
 func (h *Handler) signUp(c *gin.Context) {
@@ -56,7 +81,7 @@ func (h *Handler) signUp(c *gin.Context) {
 	user, err := h.manager.SignUp(ctx, &request)
 
 	if err != nil {
-		api.Error(c, http.StatusInternalServerError, err)
+		h.passwordError(c, err)
 		return
 	}
 
@@ -75,7 +100,19 @@ func (h *Handler) authenticate(c *gin.Context) {
 		return
 	}
 
-	response, err := h.manager.Authenticate(ctx, &request)
+	response, err := h.manager.Authenticate(ctx, &request, &session.Client{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	var throttledError *throttle.ThrottledError
+
+	if errors.As(err, &throttledError) {
+		c.Header("Retry-After", strconv.Itoa(int(throttledError.RetryAfter.Seconds())+1))
+		api.Error(c, http.StatusTooManyRequests, err)
+		return
+	}
+
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, err)
 		return
@@ -84,6 +121,53 @@ func (h *Handler) authenticate(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+func (h *Handler) forgotPassword(c *gin.Context) {
+	var request user.ForgotPasswordRequest
+	err := c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// The reset runs in the background, so that the response time does not
+	// tell whether the account exists.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := h.manager.ForgotPassword(ctx, &request)
+
+		if err != nil {
+			zap.L().Info("password reset email not sent", zap.Error(err))
+		}
+	}()
+
+	api.Success(c, http.StatusAccepted, "if the account exists, a password reset email has been sent")
+}
+
+func (h *Handler) confirmPasswordReset(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	var request user.PasswordResetConfirmationRequest
+	err := c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	err = h.manager.ConfirmPasswordReset(ctx, &request)
+
+	if err != nil {
+		h.passwordError(c, err)
+		return
+	}
+
+	api.Success(c, http.StatusOK, "password reset successfully")
+}
+
 func (h *Handler) get(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, 1*time.Second)
 	defer cancel()
@@ -100,7 +184,41 @@ func (h *Handler) get(c *gin.Context) {
 		return
 	}
 
-	u, err := h.manager.Get(ctx, a.ActorID)
+	u, err := h.manager.GetByOrganization(ctx, a.ActorID, a.OrganizationID)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+func (h *Handler) updateProfile(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	var request user.ProfileUpdateRequest
+	err = c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.manager.UpdateProfile(ctx, a.ActorID, &request)
 
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, err)
@@ -110,11 +228,59 @@ func (h *Handler) get(c *gin.Context) {
 	c.JSON(http.StatusOK, u)
 }
 
+func (h *Handler) resendEmailVerification(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	err = h.manager.ResendEmailVerification(ctx, a.ActorID)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	api.Success(c, http.StatusAccepted, "verification email sent")
+}
+
+func (h *Handler) verifyEmail(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	var request user.EmailVerificationRequest
+	err := c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.manager.VerifyEmail(ctx, &request)
+
+	if err != nil {
+		h.passwordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
 func (h *Handler) changePassword(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, 5*time.Second)
 	defer cancel()
 
-	a, err := h.authenticator.ValidateContext(c, ctx)
+	a, err := h.authenticator.ValidatePasswordChangeContext(c, ctx)
 
 	if err != nil {
 		api.Error(c, http.StatusUnauthorized, err)
@@ -134,17 +300,81 @@ func (h *Handler) changePassword(c *gin.Context) {
 		return
 	}
 
-	u, err := h.manager.ChangePassword(ctx, a.ActorID, &request)
+	u, err := h.manager.ChangePassword(ctx, a.ActorID, a.OrganizationID, a.SessionID, &request)
 
 	if err != nil {
-		api.Error(c, http.StatusInternalServerError, err)
+		h.passwordError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+func (h *Handler) renameSelf(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	h.renameUser(c, ctx, a.ActorID, a)
+}
+
+func (h *Handler) rename(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 10*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	h.renameUser(c, ctx, userID, a)
+}
+
+func (h *Handler) renameUser(c *gin.Context, ctx context.Context, userID string, a *authentication.AuthenticatedActor) {
+	var request user.UsernameChangeRequest
+	err := c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.manager.Rename(ctx, userID, &request, a)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, u)
 }
 
-func (h *Handler) add(c *gin.Context) {
+func (h *Handler) usernameChanges(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c, 5*time.Second)
 	defer cancel()
 
@@ -160,22 +390,90 @@ func (h *Handler) add(c *gin.Context) {
 		return
 	}
 
-	var request user.AdditionRequest
-	err = c.ShouldBindJSON(&request)
+	request, err := pagination.Parse(c)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.manager.ListUsernameChanges(ctx, a.OrganizationID, request)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	pagination.Respond(c, page)
+}
+
+func (h *Handler) organizations(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	request, err := pagination.Parse(c)
 
 	if err != nil {
 		api.Error(c, http.StatusBadRequest, err)
 		return
 	}
 
-	p, err := h.manager.Add(ctx, &request, a)
+	page, err := h.manager.Organizations(ctx, a.ActorID, request)
 
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, p)
+	pagination.Respond(c, page)
+}
+
+func (h *Handler) switchOrganization(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if a.ActorType != actor.TypeUser {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	organizationID, ok := c.Params.Get("organizationID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "organization id is required")
+		return
+	}
+
+	response, err := h.manager.SwitchOrganization(ctx, a.ActorID, organizationID, &session.Client{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+
+	if err != nil {
+		api.Error(c, http.StatusForbidden, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func (h *Handler) delete(c *gin.Context) {
@@ -201,7 +499,7 @@ func (h *Handler) delete(c *gin.Context) {
 		return
 	}
 
-	u, err := h.manager.Delete(ctx, userID, a.OrganizationID)
+	u, err := h.manager.Delete(ctx, userID, a)
 
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, err)
@@ -222,16 +520,31 @@ func (h *Handler) list(c *gin.Context) {
 		return
 	}
 
-	page, size := api.Page(c)
+	var request user.ListRequest
+	err = c.ShouldBindQuery(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	request.Metadata = c.QueryMap("metadata")
+
+	pageRequest, err := pagination.Parse(c)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
 
-	users, err := h.manager.List(ctx, a.OrganizationID, page, size)
+	page, err := h.manager.List(ctx, a.OrganizationID, &request, pageRequest)
 
 	if err != nil {
 		api.Error(c, http.StatusInternalServerError, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	pagination.Respond(c, page)
 }
 
 func (h *Handler) getByOrganization(c *gin.Context) {
@@ -335,3 +648,158 @@ func (h *Handler) changeAdmin(c *gin.Context) {
 
 	c.JSON(http.StatusOK, u)
 }
+
+func (h *Handler) updateMetadata(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	var request user.MetadataUpdateRequest
+	err = c.ShouldBindJSON(&request)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := h.manager.UpdateMetadata(ctx, userID, a.OrganizationID, &request)
+
+	var validationError *attribute.ValidationError
+
+	switch {
+	case errors.As(err, &validationError):
+		c.AbortWithStatusJSON(http.StatusBadRequest, &attribute.ValidationResponse{
+			Success:    false,
+			Message:    validationError.Error(),
+			Violations: validationError.Violations,
+		})
+	case err != nil:
+		api.Error(c, http.StatusInternalServerError, err)
+	default:
+		c.JSON(http.StatusOK, u)
+	}
+}
+
+func (h *Handler) unlock(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	u, err := h.manager.Unlock(ctx, userID, a.OrganizationID)
+
+	if err != nil {
+		api.Error(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+func (h *Handler) suspend(c *gin.Context) {
+	h.changeStatus(c, h.manager.Suspend)
+}
+
+func (h *Handler) reactivate(c *gin.Context) {
+	h.changeStatus(c, h.manager.Reactivate)
+}
+
+func (h *Handler) restore(c *gin.Context) {
+	h.changeStatus(c, h.manager.Restore)
+}
+
+func (h *Handler) changeStatus(c *gin.Context, change func(context.Context, string, string, *authentication.AuthenticatedActor) (*Member, error)) {
+	ctx, cancel := context.WithTimeout(c, 5*time.Second)
+	defer cancel()
+
+	a, err := h.authenticator.ValidateContext(c, ctx)
+
+	if err != nil {
+		api.Error(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if !a.HasFullAccess {
+		api.ErrorMessage(c, http.StatusForbidden, "not allowed")
+		return
+	}
+
+	userID, ok := c.Params.Get("userID")
+
+	if !ok {
+		api.ErrorMessage(c, http.StatusBadRequest, "user id is required")
+		return
+	}
+
+	var request user.StatusChangeRequest
+	err = c.ShouldBindJSON(&request)
+
+	if err != nil && !errors.Is(err, io.EOF) {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	u, err := change(ctx, userID, request.Reason, a)
+
+	if err != nil {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, u)
+}
+
+func (h *Handler) passwordError(c *gin.Context, err error) {
+	var violationError *password.PolicyViolationError
+
+	if errors.As(err, &violationError) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, &password.PolicyViolationResponse{
+			Success:    false,
+			Message:    violationError.Error(),
+			Violations: violationError.Violations,
+		})
+		return
+	}
+
+	if errors.Is(err, token.ErrInvalid) {
+		api.Error(c, http.StatusBadRequest, err)
+		return
+	}
+
+	api.Error(c, http.StatusInternalServerError, err)
+}
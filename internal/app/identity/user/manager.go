@@ -2,331 +2,2489 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/kamva/mgm/v3"
 	"github.com/kamva/mgm/v3/field"
-	"github.com/sethvargo/go-password/password"
 	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/breach"
+	"github.com/superstackhq/identity/internal/app/identity/mail"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
+	"github.com/superstackhq/identity/internal/app/identity/naming"
 	"github.com/superstackhq/identity/internal/app/identity/organization"
+	"github.com/superstackhq/identity/internal/app/identity/pagination"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/session"
+	"github.com/superstackhq/identity/internal/app/identity/throttle"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/pkg/actor"
+	organizationapi "github.com/superstackhq/identity/pkg/organization"
 	"github.com/superstackhq/identity/pkg/user"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"golang.org/x/crypto/bcrypt"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
 )
 
+const (
+	passwordResetTokenValidity     = 1 * time.Hour
+	emailVerificationTokenValidity = 24 * time.Hour
+	streamBatchSize                = 500
+)
+
+// ErrExistingIdentity is returned by Import when the email belongs to a
+// verified identity, which has to accept an invitation to join instead.
+var ErrExistingIdentity = errors.New("email belongs to an existing user")
+
+// legacyEmailIndex enforced verified email uniqueness per organization before
+// users were split into identities and memberships.
+const legacyEmailIndex = "organization_id_1_email_1"
+
 type Manager struct {
 	organizationManager *organization.Manager
+	membershipManager   *membership.Manager
 	authenticator       *authentication.Authenticator
+	breachChecker       breach.Checker
+	hasher              *password.Hasher
+	tokenManager        *token.Manager
+	throttleManager     *throttle.Manager
+	sessionManager      *session.Manager
+	mailTransport       mail.Transport
+	config              *Config
 }
 
-func NewManager(organizationManager *organization.Manager, authenticator *authentication.Authenticator) *Manager {
+func NewManager(organizationManager *organization.Manager, membershipManager *membership.Manager, authenticator *authentication.Authenticator, breachChecker breach.Checker, hasher *password.Hasher, tokenManager *token.Manager, throttleManager *throttle.Manager, sessionManager *session.Manager, mailTransport mail.Transport, config *Config) *Manager {
 	return &Manager{
 		organizationManager: organizationManager,
+		membershipManager:   membershipManager,
 		authenticator:       authenticator,
+		breachChecker:       breachChecker,
+		hasher:              hasher,
+		tokenManager:        tokenManager,
+		throttleManager:     throttleManager,
+		sessionManager:      sessionManager,
+		mailTransport:       mailTransport,
+		config:              config,
 	}
 }
 
-func (m *Manager) SignUp(ctx context.Context, signUpRequest *user.SignUpRequest) (*User, error) {
+func (m *Manager) EnsureIndexes(ctx context.Context) error {
+	err := m.unverifyDuplicateEmails(ctx)
 
-	organizationExists, err := m.organizationManager.NameExists(ctx, signUpRequest.OrganizationName)
+	if err != nil {
+		return err
+	}
+
+	_, err = mgm.Coll(&User{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "email", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}, {Key: "email_verified", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"email_verified": true, "deleted": false}),
+		},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+		},
+	})
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if organizationExists {
-		return nil, fmt.Errorf("organization %s already exists", signUpRequest.OrganizationName)
+	_, err = mgm.Coll(&UsernameChange{}).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "organization_ids", Value: 1}, {Key: "_id", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+	})
+
+	return err
+}
+
+// unverifyDuplicateEmails keeps only the oldest verification of emails that
+// several users verified before verified emails were unique across the
+// service. The other users have to verify their email again.
+func (m *Manager) unverifyDuplicateEmails(ctx context.Context) error {
+	coll := mgm.Coll(&User{})
+
+	cursor, err := coll.Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"email_verified": true, "deleted": false}},
+		bson.M{"$sort": bson.D{{Key: "created_at", Value: 1}, {Key: field.ID, Value: 1}}},
+		bson.M{"$group": bson.M{
+			field.ID: "$email",
+			"ids":    bson.M{"$push": "$_id"},
+			"count":  bson.M{"$sum": 1},
+		}},
+		bson.M{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var groups []struct {
+		IDs []primitive.ObjectID `bson:"ids"`
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(signUpRequest.Password), bcrypt.DefaultCost)
+	err = cursor.All(ctx, &groups)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	user := &User{
-		Username:       signUpRequest.Username,
-		Password:       string(hashedPassword),
-		OrganizationID: "",
-		Admin:          true,
-		CreatorType:    "",
-		CreatorID:      "",
+	for _, group := range groups {
+		zap.L().Warn("unverifying email verified by several users", zap.String("kept", group.IDs[0].Hex()),
+			zap.Int("unverified", len(group.IDs)-1))
+
+		_, err = coll.UpdateMany(ctx, bson.M{
+			field.ID: bson.M{"$in": group.IDs[1:]},
+		}, bson.M{
+			"$set": bson.M{"email_verified": false},
+		})
+
+		if err != nil {
+			return err
+		}
 	}
 
-	err = mgm.Coll(user).CreateWithCtx(ctx, user)
+	return nil
+}
+
+// MigrateMemberships moves the organization fields of users stored before
+// identities and memberships were split into memberships of their own.
+func (m *Manager) MigrateMemberships(ctx context.Context) error {
+	coll := mgm.Coll(&User{})
+
+	specifications, err := coll.Indexes().ListSpecifications(ctx)
 
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	for _, specification := range specifications {
+		if specification.Name == legacyEmailIndex {
+			_, err = coll.Indexes().DropOne(ctx, legacyEmailIndex)
+
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	org, err := m.organizationManager.Save(ctx, signUpRequest.OrganizationName, user.ID.Hex())
+	var legacyUsers []*legacyUser
+
+	err = coll.SimpleFindWithCtx(ctx, &legacyUsers, bson.M{
+		"organization_id": bson.M{"$exists": true},
+	})
 
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	for _, l := range legacyUsers {
+		exists, err := m.membershipManager.Exists(ctx, l.ID.Hex(), l.OrganizationID)
+
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			status := l.Status
+
+			if len(status) == 0 {
+				status = membership.StatusActive
+			}
+
+			err = m.membershipManager.Create(ctx, &membership.Membership{
+				UserID:         l.ID.Hex(),
+				OrganizationID: l.OrganizationID,
+				Username:       l.Username,
+				Email:          l.Email,
+				Admin:          l.Admin,
+				Status:         status,
+				CreatorType:    l.CreatorType,
+				CreatorID:      l.CreatorID,
+				Deleted:        l.Deleted,
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = coll.UpdateByID(ctx, l.ID, bson.M{
+			"$unset": bson.M{
+				"organization_id": "",
+				"admin":           "",
+				"status":          "",
+				"creator_type":    "",
+				"creator_id":      "",
+			},
+		})
+
+		if err != nil {
+			return err
+		}
 	}
 
-	user.OrganizationID = org.ID.Hex()
+	return m.backfillMemberships(ctx)
+}
 
-	err = mgm.Coll(user).UpdateWithCtx(ctx, user)
+// backfillMemberships copies the username and email of users onto memberships
+// created before they were stored there.
+func (m *Manager) backfillMemberships(ctx context.Context) error {
+	userIDs, err := m.membershipManager.ListUsersWithoutIdentity(ctx)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return user, nil
+	for _, userID := range userIDs {
+		u, err := m.getWithDeleted(ctx, userID)
+
+		if err != nil {
+			return err
+		}
+
+		err = m.membershipManager.SyncIdentity(ctx, userID, u.Username, u.Email)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateUsernames renames users whose usernames only differ by case or
+// look-alike characters from an older member of the same organization, then
+// enforces uniqueness. Every rename is recorded as a username change.
+func (m *Manager) MigrateUsernames(ctx context.Context) error {
+	err := m.membershipManager.BackfillUsernameKeys(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	// Usernames are shared across organizations, so a rename can resolve or
+	// reshape other groups. Groups are looked up again until none are left.
+	for {
+		duplicates, err := m.membershipManager.ListDuplicateUsernames(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		if len(duplicates) == 0 {
+			break
+		}
+
+		group := duplicates[0]
+		kept, ms := group[0], group[1]
+
+		u, err := m.Get(ctx, ms.UserID)
+
+		if err != nil {
+			return err
+		}
+
+		username, err := m.availableUsername(ctx, u)
+
+		if err != nil {
+			return err
+		}
+
+		change, err := m.rename(ctx, u, username, &UsernameChange{
+			Reason:        UsernameChangeReasonMigration,
+			ConflictsWith: kept.UserID,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		zap.L().Warn("renamed user with a duplicate username",
+			zap.String("user", change.UserID),
+			zap.String("old", change.OldUsername),
+			zap.String("new", change.NewUsername),
+			zap.String("conflicts_with", change.ConflictsWith))
+	}
+
+	return m.membershipManager.EnsureUsernameIndex(ctx)
+}
+
+// availableUsername finds a numbered variant of the username of the user
+// that is free in all of their organizations.
+func (m *Manager) availableUsername(ctx context.Context, u *User) (string, error) {
+	memberships, err := m.membershipManager.ListByUser(ctx, u.ID.Hex())
+
+	if err != nil {
+		return "", err
+	}
+
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s-%d", u.Username, n)
+		taken, err := m.usernameTaken(ctx, candidate, u.ID.Hex(), memberships)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !taken {
+			return candidate, nil
+		}
+	}
 }
 
-func (m *Manager) Authenticate(ctx context.Context, authenticationRequest *user.AuthenticationRequest) (*user.AuthenticationResponse, error) {
-	org, err := m.organizationManager.GetByName(ctx, authenticationRequest.OrganizationName)
+// usernameTaken reports whether another member of any of the organizations
+// already uses a username indistinguishable from the given one.
+func (m *Manager) usernameTaken(ctx context.Context, username string, userID string, memberships []*membership.Membership) (bool, error) {
+	for _, ms := range memberships {
+		other, err := m.membershipManager.GetByUsername(ctx, ms.OrganizationID, username)
+
+		if err != nil {
+			return false, err
+		}
+
+		if other != nil && other.UserID != userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// rename changes the username of the user everywhere and records the change.
+func (m *Manager) rename(ctx context.Context, u *User, username string, change *UsernameChange) (*UsernameChange, error) {
+	memberships, err := m.membershipManager.ListByUser(ctx, u.ID.Hex())
 
 	if err != nil {
 		return nil, err
 	}
 
-	u := &User{}
+	change.UserID = u.ID.Hex()
+	change.OldUsername = u.Username
+	change.NewUsername = username
+	change.OrganizationIDs = make([]string, 0, len(memberships))
+
+	for _, ms := range memberships {
+		change.OrganizationIDs = append(change.OrganizationIDs, ms.OrganizationID)
+	}
 
-	err = mgm.Coll(u).FirstWithCtx(ctx, bson.M{
-		"organization_id": org.ID.Hex(),
-		"username":        authenticationRequest.Username,
-		"deleted":         false,
-	}, u)
+	err = m.membershipManager.SyncIdentity(ctx, u.ID.Hex(), username, u.Email)
 
-	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("invalid username and password combination")
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("username %s is already taken", username)
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(authenticationRequest.Password))
+	u.Username = username
+
+	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
 
 	if err != nil {
-		return nil, fmt.Errorf("invalid username and password combination")
+		return nil, err
 	}
 
-	token, err := m.authenticator.GenerateToken(u.ID.Hex(), u.OrganizationID, u.Admin)
+	err = mgm.Coll(change).CreateWithCtx(ctx, change)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &user.AuthenticationResponse{
-		Token: token,
-	}, nil
+	return change, nil
 }
 
-func (m *Manager) Get(ctx context.Context, userID string) (*User, error) {
-	id, err := primitive.ObjectIDFromHex(userID)
+func (m *Manager) SignUp(ctx context.Context, signUpRequest *user.SignUpRequest) (*Member, error) {
+
+	organizationExists, err := m.organizationManager.NameExists(ctx, signUpRequest.OrganizationName)
 
 	if err != nil {
 		return nil, err
 	}
 
-	user := &User{}
+	if organizationExists {
+		return nil, fmt.Errorf("organization %s already exists", signUpRequest.OrganizationName)
+	}
 
-	err = mgm.Coll(user).FirstWithCtx(ctx, bson.M{
-		field.ID:  id,
-		"deleted": false,
-	}, user)
+	username, err := naming.NormalizeUsername(signUpRequest.Username)
 
-	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("user not found")
+	if err != nil {
+		return nil, err
+	}
+
+	u := &User{
+		Username: username,
+		Email:    normalizeEmail(signUpRequest.Email),
 	}
 
+	err = m.setPassword(u, signUpRequest.Password, password.DefaultPolicy())
+
 	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
-}
-
-func (m *Manager) GetByOrganization(ctx context.Context, userID string, organizationID string) (*User, error) {
-	id, err := primitive.ObjectIDFromHex(userID)
+	err = mgm.Coll(u).CreateWithCtx(ctx, u)
 
 	if err != nil {
 		return nil, err
 	}
 
-	user := &User{}
+	org, err := m.organizationManager.Save(ctx, signUpRequest.OrganizationName, u.ID.Hex())
 
-	err = mgm.Coll(user).FirstWithCtx(ctx, bson.M{
-		field.ID:          id,
-		"organization_id": organizationID,
-		"deleted":         false,
-	}, user)
+	if err != nil {
+		// Another sign up may have taken the name since it was checked.
+		_ = mgm.Coll(u).DeleteWithCtx(ctx, u)
+		return nil, err
+	}
 
-	if err == mongo.ErrNoDocuments {
-		return nil, fmt.Errorf("user not found")
+	ms := &membership.Membership{
+		UserID:         u.ID.Hex(),
+		OrganizationID: org.ID.Hex(),
+		Username:       u.Username,
+		Email:          u.Email,
+		Admin:          true,
 	}
 
+	ms.SetStatus(membership.StatusActive, actor.TypeUser, u.ID.Hex(), "")
+
+	err = m.membershipManager.Create(ctx, ms)
+
 	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	if len(u.Email) != 0 {
+		err = m.sendEmailVerification(ctx, u)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return newMember(u, ms), nil
 }
 
-func (m *Manager) ChangePassword(ctx context.Context, userID string, passwordChangeRequest *user.PasswordChangeRequest) (*User, error) {
-	user, err := m.Get(ctx, userID)
+func (m *Manager) Authenticate(ctx context.Context, authenticationRequest *user.AuthenticationRequest, client *session.Client) (*user.AuthenticationResponse, error) {
+	if len(authenticationRequest.Email) != 0 {
+		return m.authenticateByEmail(ctx, authenticationRequest, client)
+	}
+
+	if len(authenticationRequest.Username) == 0 || (len(authenticationRequest.OrganizationSlug) == 0 && len(authenticationRequest.OrganizationName) == 0) {
+		return nil, fmt.Errorf("either email or username and organization slug or name are required")
+	}
+
+	org, err := m.organizationManager.Lookup(ctx, authenticationRequest.OrganizationSlug, authenticationRequest.OrganizationName)
 
 	if err != nil {
 		return nil, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(passwordChangeRequest.Password), bcrypt.DefaultCost)
+	event := &session.LoginEvent{
+		OrganizationID: org.ID.Hex(),
+		Username:       authenticationRequest.Username,
+		Method:         session.MethodPassword,
+		IP:             client.IP,
+		UserAgent:      client.UserAgent,
+	}
+
+	throttleKey := m.throttleKey(org.ID.Hex(), authenticationRequest.Username)
+
+	err = m.throttleManager.Check(ctx, throttleKey, client.IP)
+
+	if err != nil {
+		event.FailureReason = err.Error()
+		return nil, m.loginFailed(ctx, event, err)
+	}
+
+	member, err := m.findByUsername(ctx, org.ID.Hex(), authenticationRequest.Username)
 
 	if err != nil {
 		return nil, err
 	}
 
-	user.Password = string(hashedPassword)
+	if member == nil || member.Status == membership.StatusInvited {
+		event.FailureReason = "unknown username"
+		return nil, m.authenticationFailed(ctx, event, throttleKey)
+	}
+
+	event.UserID = member.ID.Hex()
+
+	if member.Status != membership.StatusActive {
+		event.FailureReason = "user " + strings.ToLower(string(member.Status))
+		return nil, m.authenticationFailed(ctx, event, throttleKey)
+	}
+
+	valid, rehash, err := m.hasher.Verify(member.Password, authenticationRequest.Password)
+
+	if err != nil || !valid {
+		event.FailureReason = "invalid password"
+		return nil, m.authenticationFailed(ctx, event, throttleKey)
+	}
 
-	err = mgm.Coll(user).UpdateWithCtx(ctx, user)
+	err = m.throttleManager.RecordSuccess(ctx, throttleKey)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return user, nil
+	return m.login(ctx, org, member, rehash, authenticationRequest.Password, event, client)
 }
 
-func (m *Manager) Add(ctx context.Context, userAdditionRequest *user.AdditionRequest, actor *authentication.AuthenticatedActor) (*user.PasswordResponse, error) {
-	usernameExists, err := m.usernameExists(ctx, userAdditionRequest.Username, actor.OrganizationID)
+func (m *Manager) authenticateByEmail(ctx context.Context, authenticationRequest *user.AuthenticationRequest, client *session.Client) (*user.AuthenticationResponse, error) {
+	email := normalizeEmail(authenticationRequest.Email)
+
+	event := &session.LoginEvent{
+		Username:  email,
+		Method:    session.MethodPassword,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}
+
+	throttleKey := m.throttleKey("email", email)
+
+	err := m.throttleManager.Check(ctx, throttleKey, client.IP)
+
+	if err != nil {
+		event.FailureReason = err.Error()
+		return nil, m.loginFailed(ctx, event, err)
+	}
+
+	var candidates []*User
+
+	err = mgm.Coll(&User{}).SimpleFindWithCtx(ctx, &candidates, bson.M{
+		"email":          email,
+		"email_verified": true,
+		"deleted":        false,
+	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	if usernameExists {
-		return nil, fmt.Errorf("username %s is already taken", userAdditionRequest.Username)
+	var matches []*Member
+	var rehash []bool
+
+	for _, candidate := range candidates {
+		valid, outdated, err := m.hasher.Verify(candidate.Password, authenticationRequest.Password)
+
+		if err != nil || !valid {
+			continue
+		}
+
+		memberships, err := m.membershipManager.ListByUser(ctx, candidate.ID.Hex())
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ms := range memberships {
+			if ms.Status == membership.StatusActive {
+				matches = append(matches, newMember(candidate, ms))
+				rehash = append(rehash, outdated)
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		event.FailureReason = "invalid email or password"
+		return nil, m.authenticationFailed(ctx, event, throttleKey)
 	}
 
-	pass, err := password.Generate(16, 4, 2, false, false)
+	err = m.throttleManager.RecordSuccess(ctx, throttleKey)
 
 	if err != nil {
 		return nil, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	index, err := m.selectOrganization(ctx, matches, authenticationRequest)
 
 	if err != nil {
 		return nil, err
 	}
 
-	u := &User{
-		Username:       userAdditionRequest.Username,
-		Password:       string(hashedPassword),
-		Admin:          userAdditionRequest.Admin,
-		CreatorType:    actor.ActorType,
-		CreatorID:      actor.ActorID,
-		OrganizationID: actor.OrganizationID,
-		Deleted:        false,
+	if index < 0 {
+		return m.organizationChoices(ctx, matches)
 	}
 
-	err = mgm.Coll(u).CreateWithCtx(ctx, u)
+	member := matches[index]
+
+	org, err := m.organizationManager.Get(ctx, member.OrganizationID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &user.PasswordResponse{Password: pass}, nil
+	event.UserID = member.ID.Hex()
+	event.OrganizationID = member.OrganizationID
+
+	return m.login(ctx, org, member, rehash[index], authenticationRequest.Password, event, client)
+}
+
+// selectOrganization picks the membership to log into when an email matches
+// memberships in several organizations. It returns -1 when the caller has to
+// choose.
+func (m *Manager) selectOrganization(ctx context.Context, matches []*Member, authenticationRequest *user.AuthenticationRequest) (int, error) {
+	organizationID := authenticationRequest.OrganizationID
+
+	if len(organizationID) == 0 && (len(authenticationRequest.OrganizationSlug) != 0 || len(authenticationRequest.OrganizationName) != 0) {
+		org, err := m.organizationManager.Lookup(ctx, authenticationRequest.OrganizationSlug, authenticationRequest.OrganizationName)
+
+		if err != nil {
+			return 0, err
+		}
+
+		organizationID = org.ID.Hex()
+	}
+
+	if len(organizationID) != 0 {
+		for i, member := range matches {
+			if member.OrganizationID == organizationID {
+				return i, nil
+			}
+		}
+
+		return 0, fmt.Errorf("invalid email and password combination for organization")
+	}
+
+	if len(matches) == 1 {
+		return 0, nil
+	}
+
+	for _, member := range matches {
+		if len(member.DefaultOrganizationID) == 0 {
+			continue
+		}
+
+		for i, candidate := range matches {
+			if candidate.OrganizationID == member.DefaultOrganizationID {
+				return i, nil
+			}
+		}
+	}
+
+	return -1, nil
+}
+
+func (m *Manager) organizationChoices(ctx context.Context, matches []*Member) (*user.AuthenticationResponse, error) {
+	choices := make([]*user.OrganizationChoice, 0, len(matches))
+
+	for _, member := range matches {
+		org, err := m.organizationManager.Get(ctx, member.OrganizationID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		choices = append(choices, &user.OrganizationChoice{
+			ID:   org.ID.Hex(),
+			Slug: org.Slug,
+			Name: org.Name,
+		})
+	}
+
+	return &user.AuthenticationResponse{
+		OrganizationSelectionRequired: true,
+		Organizations:                 choices,
+	}, nil
 }
 
-func (m *Manager) Delete(ctx context.Context, userID string, organizationID string) (*User, error) {
-	u, err := m.GetByOrganization(ctx, userID, organizationID)
+func (m *Manager) login(ctx context.Context, org *organization.Organization, member *Member, rehash bool, pass string, event *session.LoginEvent, client *session.Client) (*user.AuthenticationResponse, error) {
+	if rehash {
+		err := m.rehashPassword(ctx, member.User, pass)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := m.flagBreachedPassword(ctx, member.User, pass)
 
 	if err != nil {
 		return nil, err
 	}
 
-	u.Deleted = true
+	passwordExpired := org.EffectivePasswordPolicy().Expired(member.PasswordChangedAt)
+	passwordChangeRequired := member.MustChangePassword || passwordExpired
 
-	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+	token, sessionID, err := m.issueToken(ctx, member, session.MethodPassword, client, passwordChangeRequired)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return u, nil
-}
-
-func (m *Manager) List(ctx context.Context, organizationID string, page int64, size int64) ([]*User, error) {
-	var users []*User
+	event.Success = true
+	event.SessionID = sessionID
 
-	err := mgm.Coll(&User{}).SimpleFindWithCtx(ctx, &users, bson.M{
-		"organization_id": organizationID,
-		"deleted":         false,
-	}, options.Find().SetSkip(page*size).SetLimit(size))
+	err = m.sessionManager.RecordLogin(ctx, event)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	return &user.AuthenticationResponse{
+		Token:                  token,
+		OrganizationID:         member.OrganizationID,
+		PasswordExpired:        passwordExpired,
+		PasswordBreached:       member.PasswordBreached,
+		PasswordChangeRequired: passwordChangeRequired,
+	}, nil
 }
 
-func (m *Manager) ResetPassword(ctx context.Context, userID string, organizationID string) (*user.PasswordResponse, error) {
-	u, err := m.GetByOrganization(ctx, userID, organizationID)
+// SwitchOrganization issues a token for another organization the user is an
+// active member of, without asking for the password again.
+func (m *Manager) SwitchOrganization(ctx context.Context, userID string, organizationID string, client *session.Client) (*user.AuthenticationResponse, error) {
+	u, ms, err := m.member(ctx, userID, organizationID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	pass, err := password.Generate(16, 4, 2, false, false)
+	if ms.Status != membership.StatusActive {
+		return nil, fmt.Errorf("membership in organization %s is not active", organizationID)
+	}
+
+	org, err := m.organizationManager.Get(ctx, organizationID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	member := newMember(u, ms)
+
+	passwordExpired := org.EffectivePasswordPolicy().Expired(u.PasswordChangedAt)
+	passwordChangeRequired := u.MustChangePassword || passwordExpired
+
+	token, sessionID, err := m.issueToken(ctx, member, session.MethodOrganizationSwitch, client, passwordChangeRequired)
 
 	if err != nil {
 		return nil, err
 	}
 
-	u.Password = string(hashedPassword)
+	err = m.sessionManager.RecordLogin(ctx, &session.LoginEvent{
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Username:       u.Username,
+		Method:         session.MethodOrganizationSwitch,
+		Success:        true,
+		IP:             client.IP,
+		UserAgent:      client.UserAgent,
+		SessionID:      sessionID,
+	})
 
-	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.AuthenticationResponse{
+		Token:                  token,
+		OrganizationID:         organizationID,
+		PasswordExpired:        passwordExpired,
+		PasswordBreached:       u.PasswordBreached,
+		PasswordChangeRequired: passwordChangeRequired,
+	}, nil
+}
+
+// Organizations lists the organizations the user is a member of.
+func (m *Manager) Organizations(ctx context.Context, userID string, request *pagination.Request) (*pagination.Page, error) {
+	u, err := m.Get(ctx, userID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &user.PasswordResponse{Password: pass}, nil
+	memberships, page, err := m.membershipManager.PageByUser(ctx, userID, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	organizations := make([]*user.OrganizationMembership, 0, len(memberships))
+
+	for _, ms := range memberships {
+		org, err := m.organizationManager.Get(ctx, ms.OrganizationID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		organizations = append(organizations, &user.OrganizationMembership{
+			ID:      org.ID.Hex(),
+			Slug:    org.Slug,
+			Name:    org.Name,
+			Admin:   ms.Admin,
+			Status:  string(ms.Status),
+			Default: org.ID.Hex() == u.DefaultOrganizationID,
+		})
+	}
+
+	page.Items = organizations
+
+	return page, nil
 }
 
-func (m *Manager) ChangeAdmin(ctx context.Context, userID string, changeAdminRequest user.AdminChangeRequest, organizationID string) (*User, error) {
-	u, err := m.GetByOrganization(ctx, userID, organizationID)
+func (m *Manager) Get(ctx context.Context, userID string) (*User, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
 
 	if err != nil {
 		return nil, err
 	}
 
-	u.Admin = changeAdminRequest.Admin
+	user := &User{}
 
-	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+	err = mgm.Coll(user).FirstWithCtx(ctx, bson.M{
+		field.ID:  id,
+		"deleted": false,
+	}, user)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("user not found")
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return u, nil
+	return user, nil
 }
 
-func (m *Manager) usernameExists(ctx context.Context, username string, organizationID string) (bool, error) {
-	count, err := mgm.Coll(&User{}).CountDocuments(ctx, bson.M{
-		"username":        username,
-		"organization_id": organizationID,
-		"deleted":         false,
-	})
+func (m *Manager) getWithDeleted(ctx context.Context, userID string) (*User, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
 
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	return count != 0, nil
+	u := &User{}
+
+	err = mgm.Coll(u).FindByIDWithCtx(ctx, id, u)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (m *Manager) GetByOrganization(ctx context.Context, userID string, organizationID string) (*Member, error) {
+	u, ms, err := m.member(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// ChangePassword sets a new password chosen by the user. Pending password
+// resets and every session but the current one end with the old password.
+func (m *Manager) ChangePassword(ctx context.Context, userID string, organizationID string, sessionID string, passwordChangeRequest *user.PasswordChangeRequest) (*Member, error) {
+	u, ms, err := m.member(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := m.organizationManager.Get(ctx, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.setPassword(u, passwordChangeRequest.Password, org.EffectivePasswordPolicy())
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.MustChangePassword = false
+
+	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.tokenManager.InvalidateAll(ctx, token.PurposePasswordReset, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.sessionManager.RevokeOthers(ctx, userID, sessionID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// Add invites a user into the actor's organization. When the email already
+// belongs to a verified identity, that identity gets a new membership instead
+// of a second account being created.
+func (m *Manager) Add(ctx context.Context, userAdditionRequest *user.AdditionRequest, actor *authentication.AuthenticatedActor) (*Member, error) {
+	u, metadata, err := m.prepareAddition(ctx, userAdditionRequest, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return m.addMember(ctx, u, userAdditionRequest.Admin, metadata, membership.StatusInvited, actor)
+}
+
+// CheckAddition runs the checks of Add without adding anyone.
+func (m *Manager) CheckAddition(ctx context.Context, userAdditionRequest *user.AdditionRequest, organizationID string) error {
+	_, _, err := m.prepareAddition(ctx, userAdditionRequest, organizationID)
+	return err
+}
+
+// Import adds a user that brings the password hash of another system along.
+// The user becomes an active member right away and the hash is upgraded on
+// their next login. The email stays unverified until its owner confirms it,
+// and emails of existing identities are refused with ErrExistingIdentity.
+func (m *Manager) Import(ctx context.Context, importRequest *user.ImportRequest, actor *authentication.AuthenticatedActor) (*Member, error) {
+	if err := m.hasher.Check(importRequest.PasswordHash); err != nil {
+		return nil, err
+	}
+
+	u, metadata, err := m.prepareAddition(ctx, &importRequest.AdditionRequest, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !u.ID.IsZero() {
+		return nil, ErrExistingIdentity
+	}
+
+	u.Password = importRequest.PasswordHash
+	u.PasswordChangedAt = time.Now().UTC()
+	u.DisplayName = importRequest.DisplayName
+	u.GivenName = importRequest.GivenName
+	u.FamilyName = importRequest.FamilyName
+	u.AvatarURL = importRequest.AvatarURL
+
+	// Imported values take precedence over the organization defaults.
+	if len(importRequest.Locale) != 0 {
+		u.Locale = importRequest.Locale
+	}
+
+	if len(importRequest.Timezone) != 0 {
+		u.Timezone = importRequest.Timezone
+	}
+
+	return m.addMember(ctx, u, importRequest.Admin, metadata, membership.StatusActive, actor)
+}
+
+// prepareAddition checks that the user can be added to the organization and
+// returns either the existing identity with the email or a new, unsaved one,
+// along with the custom attributes validated against the schema.
+func (m *Manager) prepareAddition(ctx context.Context, userAdditionRequest *user.AdditionRequest, organizationID string) (*User, map[string]interface{}, error) {
+	email := normalizeEmail(userAdditionRequest.Email)
+
+	org, err := m.organizationManager.Get(ctx, organizationID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !org.Settings.AllowsEmail(email) {
+		return nil, nil, fmt.Errorf("%s is not in an email domain allowed by the organization", email)
+	}
+
+	metadata, err := org.AttributeSchema.Validate(userAdditionRequest.Metadata)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u, err := m.findByVerifiedEmail(ctx, email)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if u != nil {
+		exists, err := m.membershipManager.Exists(ctx, u.ID.Hex(), organizationID)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if exists {
+			return nil, nil, fmt.Errorf("%s is already a member of the organization", email)
+		}
+	} else {
+		u = &User{
+			Username: userAdditionRequest.Username,
+			Email:    email,
+			Locale:   org.Settings.DefaultLocale,
+			Timezone: org.Settings.DefaultTimezone,
+		}
+
+		if len(u.Username) != 0 {
+			u.Username, err = naming.NormalizeUsername(u.Username)
+
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	usernameExists, err := m.usernameExists(ctx, u.Username, organizationID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if usernameExists {
+		return nil, nil, fmt.Errorf("username %s is already taken", u.Username)
+	}
+
+	return u, metadata, nil
+}
+
+func (m *Manager) addMember(ctx context.Context, u *User, admin bool, metadata map[string]interface{}, status membership.Status, actor *authentication.AuthenticatedActor) (*Member, error) {
+	if u.ID.IsZero() {
+		err := mgm.Coll(u).CreateWithCtx(ctx, u)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ms := &membership.Membership{
+		UserID:         u.ID.Hex(),
+		OrganizationID: actor.OrganizationID,
+		Username:       u.Username,
+		Email:          u.Email,
+		Admin:          admin,
+		CreatorType:    actor.ActorType,
+		CreatorID:      actor.ActorID,
+		Metadata:       metadata,
+	}
+
+	ms.SetStatus(status, actor.ActorType, actor.ActorID, "")
+
+	err := m.membershipManager.Create(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// Activate completes an invitation. A new identity chooses its password here,
+// while an existing identity confirms the invitation with its current one.
+func (m *Manager) Activate(ctx context.Context, userID string, organizationID string, pass string) (*Member, error) {
+	u, ms, err := m.member(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.Status != membership.StatusInvited {
+		return nil, fmt.Errorf("user %s is not pending activation", userID)
+	}
+
+	org, err := m.organizationManager.Get(ctx, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u.Password) != 0 {
+		valid, _, err := m.hasher.Verify(u.Password, pass)
+
+		if err != nil || !valid {
+			return nil, fmt.Errorf("invalid password")
+		}
+	} else {
+		err = m.setPassword(u, pass, org.EffectivePasswordPolicy())
+
+		if err != nil {
+			return nil, err
+		}
+
+		u.MustChangePassword = false
+	}
+
+	if !u.EmailVerified && len(u.Email) != 0 {
+		taken, err := m.verifiedEmailExists(ctx, u.Email, userID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		u.EmailVerified = !taken
+	}
+
+	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ms.SetStatus(membership.StatusActive, actor.TypeUser, userID, "invitation accepted")
+
+	err = m.membershipManager.Update(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// Delete removes the user from the organization. The identity itself is
+// deleted once it no longer belongs to any organization. Both can be restored
+// within the retention window.
+func (m *Manager) Delete(ctx context.Context, userID string, actor *authentication.AuthenticatedActor) (*Member, error) {
+	u, ms, err := m.member(ctx, userID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.checkRemovable(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ms.SetStatus(membership.StatusDeleted, actor.ActorType, actor.ActorID, "")
+
+	err = m.membershipManager.Update(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := m.membershipManager.Count(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if remaining == 0 {
+		u.Deleted = true
+		u.DeletedAt = ms.DeletedAt
+
+		err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = m.sessionManager.RevokeOrganization(ctx, userID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// Suspend blocks the user from authenticating into the organization and
+// revokes their sessions there, keeping everything else intact.
+func (m *Manager) Suspend(ctx context.Context, userID string, reason string, actor *authentication.AuthenticatedActor) (*Member, error) {
+	if userID == actor.ActorID {
+		return nil, fmt.Errorf("you cannot suspend yourself")
+	}
+
+	u, ms, err := m.member(ctx, userID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.Status != membership.StatusActive {
+		return nil, fmt.Errorf("user %s is not active", userID)
+	}
+
+	err = m.checkRemovable(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ms.SetStatus(membership.StatusSuspended, actor.ActorType, actor.ActorID, reason)
+
+	err = m.membershipManager.Update(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.sessionManager.RevokeOrganization(ctx, userID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+func (m *Manager) Reactivate(ctx context.Context, userID string, reason string, actor *authentication.AuthenticatedActor) (*Member, error) {
+	u, ms, err := m.member(ctx, userID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.Status != membership.StatusSuspended {
+		return nil, fmt.Errorf("user %s is not suspended", userID)
+	}
+
+	ms.SetStatus(membership.StatusActive, actor.ActorType, actor.ActorID, reason)
+
+	err = m.membershipManager.Update(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// Restore brings back a user deleted from the organization within the
+// retention window, in the state they had before the deletion.
+func (m *Manager) Restore(ctx context.Context, userID string, reason string, actor *authentication.AuthenticatedActor) (*Member, error) {
+	exists, err := m.membershipManager.Exists(ctx, userID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, fmt.Errorf("user %s is not deleted", userID)
+	}
+
+	ms, err := m.membershipManager.GetDeleted(ctx, userID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.DeletedAt == nil || time.Since(*ms.DeletedAt) > m.config.Retention {
+		return nil, fmt.Errorf("user %s was deleted outside the %s retention window", userID, m.config.Retention)
+	}
+
+	u, err := m.getWithDeleted(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	usernameExists, err := m.usernameExists(ctx, u.Username, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if usernameExists {
+		return nil, fmt.Errorf("username %s has been taken since the user was deleted", u.Username)
+	}
+
+	if u.Deleted {
+		u.Deleted = false
+		u.DeletedAt = nil
+
+		err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ms.SetStatus(ms.PreviousStatus(), actor.ActorType, actor.ActorID, reason)
+
+	err = m.membershipManager.Update(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// DeleteOrganization soft deletes the organization of the actor together
+// with its memberships, sessions and pending tokens. Users left without any
+// organization are deleted too. The returned token restores all of it within
+// the retention window and is also mailed to the contact of the
+// organization.
+func (m *Manager) DeleteOrganization(ctx context.Context, actor *authentication.AuthenticatedActor) (*organizationapi.DeletionResponse, error) {
+	org, err := m.organizationManager.Get(ctx, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if org.OwnerID != actor.ActorID {
+		return nil, fmt.Errorf("only the owner can delete the organization")
+	}
+
+	err = m.organizationManager.MarkDeleted(ctx, org, actor.ActorID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := m.membershipManager.ListByOrganization(ctx, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ms := range memberships {
+		ms.SetStatus(membership.StatusDeleted, actor.ActorType, actor.ActorID, "organization deleted")
+		ms.DeletedWithOrganization = true
+
+		err = m.membershipManager.Update(ctx, ms)
+
+		if err != nil {
+			return nil, err
+		}
+
+		remaining, err := m.membershipManager.Count(ctx, ms.UserID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if remaining == 0 {
+			u, err := m.Get(ctx, ms.UserID)
+
+			if err != nil {
+				return nil, err
+			}
+
+			u.Deleted = true
+			u.DeletedAt = ms.DeletedAt
+
+			err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = m.sessionManager.RevokeAllInOrganization(ctx, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.tokenManager.InvalidateOrganization(ctx, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := m.tokenManager.Issue(ctx, token.PurposeOrganizationRestore, actor.ActorID, actor.OrganizationID, m.config.Retention)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response := &organizationapi.DeletionResponse{
+		RestoreToken:  plaintext,
+		RestoreBefore: org.DeletedAt.Add(m.config.Retention),
+	}
+
+	if len(org.ContactEmail) != 0 {
+		err = m.mailTransport.Send(ctx, &mail.Message{
+			To:      org.ContactEmail,
+			Subject: fmt.Sprintf("%s has been deleted", org.Name),
+			Body: fmt.Sprintf("The organization %s and its users have been deleted.\n\n"+
+				"Use the link below to restore them before %s. It can only be used once.\n\n%s\n",
+				org.Name, response.RestoreBefore.Format(time.RFC1123), m.link("/restore-organization", plaintext)),
+		})
+
+		if err != nil {
+			zap.L().Error("error while sending organization deletion email", zap.String("organization", org.ID.Hex()), zap.Error(err))
+		}
+	}
+
+	return response, nil
+}
+
+// RestoreOrganization brings back an organization deleted with
+// DeleteOrganization and the members deleted along with it.
+func (m *Manager) RestoreOrganization(ctx context.Context, restoreRequest *organizationapi.RestoreRequest) (*organization.Organization, error) {
+	// Consuming the token first lets only one of several concurrent requests
+	// with it go on.
+	t, err := m.tokenManager.Consume(ctx, token.PurposeOrganizationRestore, restoreRequest.Token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := m.organizationManager.GetDeleted(ctx, t.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.organizationManager.MarkRestored(ctx, org)
+
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := m.membershipManager.ListDeletedWithOrganization(ctx, org.ID.Hex())
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ms := range memberships {
+		u, err := m.getWithDeleted(ctx, ms.UserID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if u.Deleted {
+			u.Deleted = false
+			u.DeletedAt = nil
+
+			err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ms.SetStatus(ms.PreviousStatus(), actor.TypeUser, t.UserID, "organization restored")
+		ms.DeletedWithOrganization = false
+
+		err = m.membershipManager.Update(ctx, ms)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return org, nil
+}
+
+// ListDeleted returns the identities that were deleted before the given time.
+func (m *Manager) ListDeleted(ctx context.Context, before time.Time) ([]*User, error) {
+	var users []*User
+
+	err := mgm.Coll(&User{}).SimpleFindWithCtx(ctx, &users, bson.M{
+		"deleted":    true,
+		"deleted_at": bson.M{"$lt": before},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// PrepareErasure returns the identity, deleted or not, and clears its login
+// throttling state. It has to run while the memberships of the user still
+// exist, and can run again if the erasure is retried.
+func (m *Manager) PrepareErasure(ctx context.Context, userID string) (*User, error) {
+	u, err := m.getWithDeleted(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, err := m.membershipManager.ListByUser(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ms := range memberships {
+		err = m.throttleManager.Reset(ctx, m.throttleKey(ms.OrganizationID, u.Username))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(u.Email) != 0 {
+		err = m.throttleManager.Reset(ctx, m.throttleKey("email", u.Email))
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
+// Erase permanently removes the identity along with its password hashes and
+// username history. References to it elsewhere are left to the caller, who
+// removes them first so that a failed erasure can still find the identity.
+func (m *Manager) Erase(ctx context.Context, u *User) error {
+	_, err := mgm.Coll(&UsernameChange{}).DeleteMany(ctx, bson.M{
+		"user_id": u.ID.Hex(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return mgm.Coll(u).DeleteWithCtx(ctx, u)
+}
+
+// Pseudonymise replaces references to the user in the username changes of
+// other users with the pseudonym.
+func (m *Manager) Pseudonymise(ctx context.Context, userID string, pseudonym string) error {
+	coll := mgm.Coll(&UsernameChange{})
+
+	_, err := coll.UpdateMany(ctx, bson.M{
+		"conflicts_with": userID,
+	}, bson.M{
+		"$set": bson.M{"conflicts_with": pseudonym},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = coll.UpdateMany(ctx, bson.M{
+		"actor_id": userID,
+	}, bson.M{
+		"$set": bson.M{"actor_id": pseudonym},
+	})
+
+	return err
+}
+
+func (m *Manager) List(ctx context.Context, organizationID string, listRequest *user.ListRequest, request *pagination.Request) (*pagination.Page, error) {
+	query, err := m.listQuery(ctx, organizationID, listRequest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	memberships, page, err := m.membershipManager.Search(ctx, organizationID, query, request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page.Items, err = m.members(ctx, memberships)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Stream calls fn with every member of the organization matching the list
+// request, fetching them from the database in batches.
+func (m *Manager) Stream(ctx context.Context, organizationID string, listRequest *user.ListRequest, fn func(*Member) error) error {
+	query, err := m.listQuery(ctx, organizationID, listRequest)
+
+	if err != nil {
+		return err
+	}
+
+	return m.membershipManager.Each(ctx, organizationID, query, streamBatchSize, func(memberships []*membership.Membership) error {
+		members, err := m.members(ctx, memberships)
+
+		if err != nil {
+			return err
+		}
+
+		for _, member := range members {
+			if err := fn(member); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *Manager) listQuery(ctx context.Context, organizationID string, listRequest *user.ListRequest) (*membership.Query, error) {
+	query := &membership.Query{
+		Search:         listRequest.Search,
+		UsernamePrefix: listRequest.UsernamePrefix,
+		EmailPrefix:    listRequest.EmailPrefix,
+		Admin:          listRequest.Admin,
+		CreatorID:      listRequest.CreatorID,
+		CreatedAfter:   listRequest.CreatedAfter,
+		CreatedBefore:  listRequest.CreatedBefore,
+		UpdatedAfter:   listRequest.UpdatedAfter,
+		UpdatedBefore:  listRequest.UpdatedBefore,
+		Sort:           strings.TrimPrefix(listRequest.Sort, "-"),
+		Descending:     strings.HasPrefix(listRequest.Sort, "-"),
+	}
+
+	for _, statuses := range listRequest.Status {
+		for _, status := range strings.Split(statuses, ",") {
+			query.Statuses = append(query.Statuses, membership.Status(strings.ToUpper(strings.TrimSpace(status))))
+		}
+	}
+
+	if len(listRequest.Metadata) != 0 {
+		org, err := m.organizationManager.Get(ctx, organizationID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		query.Metadata, err = org.AttributeSchema.Filter(listRequest.Metadata)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
+func (m *Manager) ResetPassword(ctx context.Context, userID string, organizationID string) (*user.PasswordResponse, error) {
+	u, _, err := m.member(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := m.membershipManager.Count(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if count > 1 {
+		return nil, fmt.Errorf("user %s belongs to other organizations and must reset their own password", userID)
+	}
+
+	org, err := m.organizationManager.Get(ctx, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	policy := org.EffectivePasswordPolicy()
+	pass, err := policy.Generate(u.Username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.setPassword(u, pass, policy)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u.MustChangePassword = true
+
+	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.sessionManager.RevokeAll(ctx, u.ID.Hex())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &user.PasswordResponse{Password: pass}, nil
+}
+
+func (m *Manager) ChangeAdmin(ctx context.Context, userID string, changeAdminRequest user.AdminChangeRequest, organizationID string) (*Member, error) {
+	u, ms, err := m.member(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.Admin && !changeAdminRequest.Admin {
+		err = m.checkRemovable(ctx, ms)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ms.Admin = changeAdminRequest.Admin
+
+	err = m.membershipManager.Update(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// UpdateMetadata merges the values into the custom attributes of the member
+// and validates the result against the schema of the organization.
+func (m *Manager) UpdateMetadata(ctx context.Context, userID string, organizationID string, metadataUpdateRequest *user.MetadataUpdateRequest) (*Member, error) {
+	u, ms, err := m.member(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	org, err := m.organizationManager.Get(ctx, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(ms.Metadata)+len(metadataUpdateRequest.Metadata))
+
+	for key, value := range ms.Metadata {
+		if org.AttributeSchema.Get(key) != nil {
+			values[key] = value
+		}
+	}
+
+	for key, value := range metadataUpdateRequest.Metadata {
+		values[key] = value
+	}
+
+	ms.Metadata, err = org.AttributeSchema.Validate(values)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.membershipManager.Update(ctx, ms)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newMember(u, ms), nil
+}
+
+// Rename changes the username of the user. Admins can only rename users that
+// belong to no other organization, since the username is shared by all of
+// them.
+func (m *Manager) Rename(ctx context.Context, userID string, usernameChangeRequest *user.UsernameChangeRequest, actor *authentication.AuthenticatedActor) (*Member, error) {
+	u, ms, err := m.member(ctx, userID, actor.OrganizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	username, err := naming.NormalizeUsername(usernameChangeRequest.Username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if username == u.Username {
+		return newMember(u, ms), nil
+	}
+
+	memberships, err := m.membershipManager.ListByUser(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if userID != actor.ActorID && len(memberships) > 1 {
+		return nil, fmt.Errorf("user %s belongs to other organizations and must change their own username", userID)
+	}
+
+	taken, err := m.usernameTaken(ctx, username, userID, memberships)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if taken {
+		return nil, fmt.Errorf("username %s is already taken", username)
+	}
+
+	_, err = m.rename(ctx, u, username, &UsernameChange{
+		Reason:    UsernameChangeReasonRename,
+		ActorType: actor.ActorType,
+		ActorID:   actor.ActorID,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	ms.Username = username
+
+	return newMember(u, ms), nil
+}
+
+// ListUsernameChanges returns the renames of members of the organization,
+// newest first.
+func (m *Manager) ListUsernameChanges(ctx context.Context, organizationID string, request *pagination.Request) (*pagination.Page, error) {
+	coll := mgm.Coll(&UsernameChange{})
+	filter := bson.M{
+		"organization_ids": organizationID,
+	}
+
+	total, err := coll.CountDocuments(ctx, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []*UsernameChange{}
+
+	err = coll.SimpleFindWithCtx(ctx, &changes, request.Filter(filter, "_id", true), request.Options("_id", true))
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := &pagination.Page{Total: total, HasMore: request.More(len(changes))}
+
+	if page.HasMore {
+		changes = changes[:request.Size]
+
+		page.NextCursor, err = pagination.Next(changes[len(changes)-1].ID, nil)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	page.Items = changes
+
+	return page, nil
+}
+
+// checkRemovable makes sure that taking the admin rights of the member away,
+// one way or another, leaves the organization with its owner and an admin.
+func (m *Manager) checkRemovable(ctx context.Context, ms *membership.Membership) error {
+	org, err := m.organizationManager.Get(ctx, ms.OrganizationID)
+
+	if err != nil {
+		return err
+	}
+
+	if org.OwnerID == ms.UserID {
+		return fmt.Errorf("user %s owns the organization and must transfer ownership first", ms.UserID)
+	}
+
+	if !ms.Admin || ms.Status != membership.StatusActive {
+		return nil
+	}
+
+	admins, err := m.membershipManager.CountAdmins(ctx, ms.OrganizationID)
+
+	if err != nil {
+		return err
+	}
+
+	if admins <= 1 {
+		return fmt.Errorf("user %s is the last admin of the organization", ms.UserID)
+	}
+
+	return nil
+}
+
+func (m *Manager) ForgotPassword(ctx context.Context, forgotPasswordRequest *user.ForgotPasswordRequest) error {
+	org, err := m.organizationManager.Lookup(ctx, forgotPasswordRequest.OrganizationSlug, forgotPasswordRequest.OrganizationName)
+
+	if err != nil {
+		return err
+	}
+
+	member, err := m.findByUsername(ctx, org.ID.Hex(), forgotPasswordRequest.Username)
+
+	if err != nil {
+		return err
+	}
+
+	if member == nil || member.Status != membership.StatusActive {
+		return fmt.Errorf("user not found")
+	}
+
+	if len(member.Email) == 0 {
+		return fmt.Errorf("user %s has no email address", member.ID.Hex())
+	}
+
+	if !member.EmailVerified {
+		return fmt.Errorf("user %s has not verified their email address", member.ID.Hex())
+	}
+
+	plaintext, err := m.tokenManager.Issue(ctx, token.PurposePasswordReset, member.ID.Hex(), member.OrganizationID, passwordResetTokenValidity)
+
+	if err != nil {
+		return err
+	}
+
+	return m.mailTransport.Send(ctx, &mail.Message{
+		To:      member.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("A password reset was requested for %s in %s.\n\n"+
+			"Use the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.\n",
+			member.Username, org.Name, passwordResetTokenValidity, m.link("/reset-password", plaintext)),
+	})
+}
+
+func (m *Manager) ConfirmPasswordReset(ctx context.Context, confirmationRequest *user.PasswordResetConfirmationRequest) error {
+	t, err := m.tokenManager.Find(ctx, token.PurposePasswordReset, confirmationRequest.Token)
+
+	if err != nil {
+		return err
+	}
+
+	u, _, err := m.member(ctx, t.UserID, t.OrganizationID)
+
+	if err != nil {
+		return err
+	}
+
+	org, err := m.organizationManager.Get(ctx, t.OrganizationID)
+
+	if err != nil {
+		return err
+	}
+
+	err = m.setPassword(u, confirmationRequest.Password, org.EffectivePasswordPolicy())
+
+	if err != nil {
+		return err
+	}
+
+	_, err = m.tokenManager.Consume(ctx, token.PurposePasswordReset, confirmationRequest.Token)
+
+	if err != nil {
+		return err
+	}
+
+	u.MustChangePassword = false
+
+	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+	if err != nil {
+		return err
+	}
+
+	err = m.sessionManager.RevokeAll(ctx, u.ID.Hex())
+
+	if err != nil {
+		return err
+	}
+
+	return m.throttleManager.Reset(ctx, m.throttleKey(t.OrganizationID, u.Username))
+}
+
+func (m *Manager) Unlock(ctx context.Context, userID string, organizationID string) (*Member, error) {
+	member, err := m.GetByOrganization(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.throttleManager.Reset(ctx, m.throttleKey(member.OrganizationID, member.Username))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+func (m *Manager) UpdateProfile(ctx context.Context, userID string, profileUpdateRequest *user.ProfileUpdateRequest) (*User, error) {
+	u, err := m.Get(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if profileUpdateRequest.Locale != nil && len(*profileUpdateRequest.Locale) != 0 {
+		tag, err := language.Parse(*profileUpdateRequest.Locale)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid locale %s", *profileUpdateRequest.Locale)
+		}
+
+		u.Locale = tag.String()
+	} else if profileUpdateRequest.Locale != nil {
+		u.Locale = ""
+	}
+
+	if profileUpdateRequest.Timezone != nil && len(*profileUpdateRequest.Timezone) != 0 {
+		_, err = time.LoadLocation(*profileUpdateRequest.Timezone)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %s", *profileUpdateRequest.Timezone)
+		}
+	}
+
+	setIfPresent(&u.DisplayName, profileUpdateRequest.DisplayName)
+	setIfPresent(&u.GivenName, profileUpdateRequest.GivenName)
+	setIfPresent(&u.FamilyName, profileUpdateRequest.FamilyName)
+	setIfPresent(&u.Timezone, profileUpdateRequest.Timezone)
+	setIfPresent(&u.AvatarURL, profileUpdateRequest.AvatarURL)
+
+	if profileUpdateRequest.DefaultOrganizationID != nil && len(*profileUpdateRequest.DefaultOrganizationID) != 0 {
+		member, err := m.membershipManager.Exists(ctx, userID, *profileUpdateRequest.DefaultOrganizationID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !member {
+			return nil, fmt.Errorf("user is not a member of organization %s", *profileUpdateRequest.DefaultOrganizationID)
+		}
+	}
+
+	setIfPresent(&u.DefaultOrganizationID, profileUpdateRequest.DefaultOrganizationID)
+
+	emailChanged := profileUpdateRequest.Email != nil && normalizeEmail(*profileUpdateRequest.Email) != u.Email
+
+	if emailChanged {
+		u.Email = normalizeEmail(*profileUpdateRequest.Email)
+		u.EmailVerified = false
+	}
+
+	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if emailChanged {
+		err = m.membershipManager.SyncIdentity(ctx, u.ID.Hex(), u.Username, u.Email)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// Links sent for the previous email must not verify the new one, and
+		// an email that was cleared has nothing to verify.
+		err = m.tokenManager.Invalidate(ctx, token.PurposeEmailVerification, u.ID.Hex(), "")
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(u.Email) != 0 {
+			err = m.sendEmailVerification(ctx, u)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return u, nil
+}
+
+func (m *Manager) ResendEmailVerification(ctx context.Context, userID string) error {
+	u, err := m.Get(ctx, userID)
+
+	if err != nil {
+		return err
+	}
+
+	if len(u.Email) == 0 {
+		return fmt.Errorf("no email address to verify")
+	}
+
+	if u.EmailVerified {
+		return fmt.Errorf("email address is already verified")
+	}
+
+	return m.sendEmailVerification(ctx, u)
+}
+
+func (m *Manager) VerifyEmail(ctx context.Context, verificationRequest *user.EmailVerificationRequest) (*User, error) {
+	t, err := m.tokenManager.Consume(ctx, token.PurposeEmailVerification, verificationRequest.Token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := m.Get(ctx, t.UserID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(u.Email) == 0 {
+		return nil, token.ErrInvalid
+	}
+
+	taken, err := m.verifiedEmailExists(ctx, u.Email, t.UserID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if taken {
+		return nil, fmt.Errorf("email %s is already in use", u.Email)
+	}
+
+	u.EmailVerified = true
+
+	err = mgm.Coll(u).UpdateWithCtx(ctx, u)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, fmt.Errorf("email %s is already in use", u.Email)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (m *Manager) sendEmailVerification(ctx context.Context, u *User) error {
+	plaintext, err := m.tokenManager.Issue(ctx, token.PurposeEmailVerification, u.ID.Hex(), "", emailVerificationTokenValidity)
+
+	if err != nil {
+		return err
+	}
+
+	return m.mailTransport.Send(ctx, &mail.Message{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm that %s is the email address for %s.\n\n"+
+			"Use the link below to verify it. It expires in %s.\n\n%s\n",
+			u.Email, u.Username, emailVerificationTokenValidity, m.link("/verify-email", plaintext)),
+	})
+}
+
+func (m *Manager) link(path string, plaintext string) string {
+	return fmt.Sprintf("%s%s?token=%s", strings.TrimSuffix(m.config.WebURL, "/"), path, url.QueryEscape(plaintext))
+}
+
+func (m *Manager) usernameExists(ctx context.Context, username string, organizationID string) (bool, error) {
+	member, err := m.findByUsername(ctx, organizationID, username)
+
+	if err != nil {
+		return false, err
+	}
+
+	return member != nil, nil
+}
+
+// verifiedEmailExists reports whether a user other than userID has verified
+// the email.
+func (m *Manager) verifiedEmailExists(ctx context.Context, email string, userID string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+
+	if err != nil {
+		return false, err
+	}
+
+	count, err := mgm.Coll(&User{}).CountDocuments(ctx, bson.M{
+		"email":          email,
+		"email_verified": true,
+		"deleted":        false,
+		field.ID:         bson.M{"$ne": id},
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
+func (m *Manager) setPassword(u *User, pass string, policy *password.Policy) error {
+	violations := policy.Validate(pass, u.Username)
+
+	if policy.HistoryDepth > 0 && m.passwordReused(u, pass, policy.HistoryDepth) {
+		violations = append(violations, password.Violation{
+			Rule:    password.RuleHistory,
+			Message: fmt.Sprintf("must not match any of the last %d passwords", policy.HistoryDepth),
+		})
+	}
+
+	breached, err := m.breachChecker.Breached(pass)
+
+	if err != nil {
+		return err
+	}
+
+	if breached {
+		violations = append(violations, password.Violation{
+			Rule:    password.RuleBreached,
+			Message: "must not appear in a known data breach",
+		})
+	}
+
+	if len(violations) != 0 {
+		return &password.PolicyViolationError{Violations: violations}
+	}
+
+	hashedPassword, err := m.hasher.Hash(pass)
+
+	if err != nil {
+		return err
+	}
+
+	if len(u.Password) != 0 {
+		u.PasswordHistory = append([]string{u.Password}, u.PasswordHistory...)
+	}
+
+	if policy.HistoryDepth == 0 {
+		u.PasswordHistory = nil
+	} else if len(u.PasswordHistory) >= policy.HistoryDepth {
+		u.PasswordHistory = u.PasswordHistory[:policy.HistoryDepth-1]
+	}
+
+	u.Password = hashedPassword
+	u.PasswordChangedAt = time.Now().UTC()
+	u.PasswordBreached = false
+
+	return nil
+}
+
+func (m *Manager) passwordReused(u *User, pass string, depth int) bool {
+	hashes := append([]string{u.Password}, u.PasswordHistory...)
+
+	if len(hashes) > depth {
+		hashes = hashes[:depth]
+	}
+
+	for _, hash := range hashes {
+		if len(hash) == 0 {
+			continue
+		}
+
+		if valid, _, err := m.hasher.Verify(hash, pass); err == nil && valid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) flagBreachedPassword(ctx context.Context, u *User, pass string) error {
+	if u.PasswordBreached {
+		return nil
+	}
+
+	breached, err := m.breachChecker.Breached(pass)
+
+	if err != nil || !breached {
+		return err
+	}
+
+	u.PasswordBreached = true
+
+	return mgm.Coll(u).UpdateWithCtx(ctx, u)
+}
+
+func (m *Manager) rehashPassword(ctx context.Context, u *User, pass string) error {
+	hashedPassword, err := m.hasher.Hash(pass)
+
+	if err != nil {
+		return err
+	}
+
+	u.Password = hashedPassword
+
+	return mgm.Coll(u).UpdateWithCtx(ctx, u)
+}
+
+func (m *Manager) authenticationFailed(ctx context.Context, event *session.LoginEvent, throttleKey string) error {
+	err := m.throttleManager.RecordFailure(ctx, throttleKey, event.IP)
+
+	if err != nil {
+		return err
+	}
+
+	return m.loginFailed(ctx, event, fmt.Errorf("invalid username and password combination"))
+}
+
+func (m *Manager) loginFailed(ctx context.Context, event *session.LoginEvent, cause error) error {
+	err := m.sessionManager.RecordLogin(ctx, event)
+
+	if err != nil {
+		return err
+	}
+
+	return cause
+}
+
+func (m *Manager) issueToken(ctx context.Context, u *Member, method session.Method, client *session.Client, restricted bool) (string, string, error) {
+	validity := m.config.SessionDuration
+
+	if restricted {
+		validity = authentication.PasswordChangeTokenValidity
+	}
+
+	s, err := m.sessionManager.Create(ctx, u.ID.Hex(), u.OrganizationID, method, client, restricted, validity)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	var t string
+
+	if restricted {
+		t, err = m.authenticator.GeneratePasswordChangeToken(u.ID.Hex(), u.OrganizationID, s.ID.Hex(), s.ExpiresAt)
+	} else {
+		var org *organization.Organization
+		org, err = m.organizationManager.Get(ctx, u.OrganizationID)
+
+		if err != nil {
+			return "", "", err
+		}
+
+		t, err = m.authenticator.GenerateToken(u.ID.Hex(), u.OrganizationID, u.Admin, org.AttributeSchema.Claims(u.Metadata), s.ID.Hex(), s.ExpiresAt)
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return t, s.ID.Hex(), nil
+}
+
+func (m *Manager) member(ctx context.Context, userID string, organizationID string) (*User, *membership.Membership, error) {
+	ms, err := m.membershipManager.Get(ctx, userID, organizationID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u, err := m.Get(ctx, userID)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return u, ms, nil
+}
+
+func (m *Manager) members(ctx context.Context, memberships []*membership.Membership) ([]*Member, error) {
+	ids := make([]primitive.ObjectID, 0, len(memberships))
+
+	for _, ms := range memberships {
+		id, err := primitive.ObjectIDFromHex(ms.UserID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	var users []*User
+
+	err := mgm.Coll(&User{}).SimpleFindWithCtx(ctx, &users, bson.M{
+		field.ID: bson.M{"$in": ids},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	usersByID := make(map[string]*User, len(users))
+
+	for _, u := range users {
+		usersByID[u.ID.Hex()] = u
+	}
+
+	members := make([]*Member, 0, len(memberships))
+
+	for _, ms := range memberships {
+		if u, ok := usersByID[ms.UserID]; ok {
+			members = append(members, newMember(u, ms))
+		}
+	}
+
+	return members, nil
+}
+
+// findByUsername returns the member of the organization whose username is
+// indistinguishable from the given one, or nil if there is none.
+func (m *Manager) findByUsername(ctx context.Context, organizationID string, username string) (*Member, error) {
+	ms, err := m.membershipManager.GetByUsername(ctx, organizationID, username)
+
+	if err != nil || ms == nil {
+		return nil, err
+	}
+
+	members, err := m.members(ctx, []*membership.Membership{ms})
+
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+
+	return members[0], nil
+}
+
+// findByVerifiedEmail returns the identity that has verified the email
+// address, or nil if there is none or the address is ambiguous.
+func (m *Manager) findByVerifiedEmail(ctx context.Context, email string) (*User, error) {
+	var users []*User
+
+	err := mgm.Coll(&User{}).SimpleFindWithCtx(ctx, &users, bson.M{
+		"email":          email,
+		"email_verified": true,
+		"deleted":        false,
+	})
+
+	if err != nil || len(users) != 1 {
+		return nil, err
+	}
+
+	return users[0], nil
+}
+
+// throttleKey identifies the failed logins of a username by its key, so that
+// every spelling that reaches the same account shares one lockout.
+func (m *Manager) throttleKey(organizationID string, username string) string {
+	return organizationID + "/" + naming.UsernameKey(username)
+}
+
+func newMember(u *User, ms *membership.Membership) *Member {
+	return &Member{
+		User:           u,
+		OrganizationID: ms.OrganizationID,
+		Admin:          ms.Admin,
+		Status:         ms.Status,
+		StatusHistory:  ms.StatusHistory,
+		CreatorType:    ms.CreatorType,
+		CreatorID:      ms.CreatorID,
+		Metadata:       ms.Metadata,
+	}
+}
+
+func setIfPresent(target *string, value *string) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
@@ -0,0 +1,406 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/internal/app/identity/attribute"
+	"github.com/superstackhq/identity/internal/app/identity/authentication"
+	"github.com/superstackhq/identity/internal/app/identity/breach"
+	"github.com/superstackhq/identity/internal/app/identity/mail"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
+	"github.com/superstackhq/identity/internal/app/identity/organization"
+	"github.com/superstackhq/identity/internal/app/identity/password"
+	"github.com/superstackhq/identity/internal/app/identity/session"
+	"github.com/superstackhq/identity/internal/app/identity/testdb"
+	"github.com/superstackhq/identity/internal/app/identity/throttle"
+	"github.com/superstackhq/identity/internal/app/identity/token"
+	"github.com/superstackhq/identity/pkg/actor"
+	organizationapi "github.com/superstackhq/identity/pkg/organization"
+	"github.com/superstackhq/identity/pkg/user"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const testPassword = "Correct-Horse-9-Battery"
+
+var testClient = &session.Client{IP: "192.0.2.1", UserAgent: "test"}
+
+var linkToken = regexp.MustCompile(`token=(\S+)`)
+
+// outbox keeps the messages sent instead of delivering them.
+type outbox struct {
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (o *outbox) Send(ctx context.Context, message *mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, message)
+
+	return nil
+}
+
+// lastToken returns the token in the link of the last message sent.
+func (o *outbox) lastToken(t *testing.T) string {
+	t.Helper()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.messages) == 0 {
+		t.Fatal("no message was sent")
+	}
+
+	match := linkToken.FindStringSubmatch(o.messages[len(o.messages)-1].Body)
+
+	if match == nil {
+		t.Fatal("message has no link")
+	}
+
+	plaintext, err := url.QueryUnescape(match[1])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return plaintext
+}
+
+type testEnv struct {
+	manager             *Manager
+	organizationManager *organization.Manager
+	membershipManager   *membership.Manager
+	sessionManager      *session.Manager
+	tokenManager        *token.Manager
+	outbox              *outbox
+}
+
+func newTestEnv(t *testing.T) (context.Context, *testEnv) {
+	ctx := testdb.Setup(t)
+
+	sessionManager := session.NewManager()
+	membershipManager := membership.NewManager()
+	organizationManager := organization.NewManager(membershipManager)
+	throttleManager := throttle.NewManager(&throttle.Config{
+		UserMaxFailures: 3,
+		IPMaxFailures:   1000,
+		FailureWindow:   time.Hour,
+		LockoutDuration: time.Hour,
+	})
+	env := &testEnv{
+		organizationManager: organizationManager,
+		membershipManager:   membershipManager,
+		sessionManager:      sessionManager,
+		tokenManager:        token.NewManager(),
+		outbox:              &outbox{},
+	}
+	env.manager = NewManager(organizationManager, membershipManager, authentication.NewAuthenticator("secret", sessionManager),
+		breach.NewNopChecker(), password.NewHasher(password.NewBcrypt(4)), env.tokenManager, throttleManager, sessionManager, env.outbox, &Config{
+			WebURL:          "http://localhost",
+			SessionDuration: time.Hour,
+			Retention:       time.Hour,
+		})
+
+	for _, ensure := range []func(context.Context) error{
+		throttleManager.EnsureIndexes,
+		sessionManager.EnsureIndexes,
+		membershipManager.EnsureIndexes,
+		organizationManager.EnsureIndexes,
+		env.manager.EnsureIndexes,
+	} {
+		if err := ensure(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return ctx, env
+}
+
+func (e *testEnv) signUp(ctx context.Context, t *testing.T, username string, email string, organizationName string) *Member {
+	t.Helper()
+
+	member, err := e.manager.SignUp(ctx, &user.SignUpRequest{
+		Username:         username,
+		Email:            email,
+		Password:         testPassword,
+		OrganizationName: organizationName,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return member
+}
+
+func (e *testEnv) authenticate(ctx context.Context, username string, pass string) error {
+	_, err := e.manager.Authenticate(ctx, &user.AuthenticationRequest{
+		Username:         username,
+		Password:         pass,
+		OrganizationName: "Acme",
+	}, testClient)
+
+	return err
+}
+
+func TestThrottleKeyIsSharedBySpellings(t *testing.T) {
+	m := &Manager{}
+	key := m.throttleKey("org", "alice")
+
+	for _, username := range []string{"Alice", "ALICE", " alice", "аlice", "ａｌｉｃｅ"} {
+		if got := m.throttleKey("org", username); got != key {
+			t.Errorf("throttleKey(%q) = %q, want %q", username, got, key)
+		}
+	}
+}
+
+func TestLockoutAppliesToEverySpelling(t *testing.T) {
+	ctx, env := newTestEnv(t)
+	member := env.signUp(ctx, t, "alice", "", "Acme")
+
+	for _, username := range []string{"ALICE", "Alice", "аlice"} {
+		if err := env.authenticate(ctx, username, "wrong password"); err == nil {
+			t.Fatalf("wrong password accepted for %q", username)
+		}
+	}
+
+	var throttled *throttle.ThrottledError
+
+	for _, username := range []string{"alice", "aLiCe", "аlice"} {
+		err := env.authenticate(ctx, username, testPassword)
+
+		if !errors.As(err, &throttled) || !throttled.Locked {
+			t.Fatalf("login as %q after lockout returned %v, want the account to be locked", username, err)
+		}
+	}
+
+	_, err := env.manager.Unlock(ctx, member.ID.Hex(), member.OrganizationID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = env.authenticate(ctx, "ALICE", testPassword); err != nil {
+		t.Fatalf("login after unlock failed: %v", err)
+	}
+}
+
+func TestEmailChangeInvalidatesVerificationLinks(t *testing.T) {
+	ctx, env := newTestEnv(t)
+	member := env.signUp(ctx, t, "alice", "alice@example.com", "Acme")
+	userID := member.ID.Hex()
+	first := env.outbox.lastToken(t)
+
+	newEmail := "alice@example.org"
+
+	if _, err := env.manager.UpdateProfile(ctx, userID, &user.ProfileUpdateRequest{Email: &newEmail}); err != nil {
+		t.Fatal(err)
+	}
+
+	second := env.outbox.lastToken(t)
+
+	if _, err := env.manager.VerifyEmail(ctx, &user.EmailVerificationRequest{Token: first}); err == nil {
+		t.Error("link sent for the previous email verified the new one")
+	}
+
+	cleared := ""
+
+	if _, err := env.manager.UpdateProfile(ctx, userID, &user.ProfileUpdateRequest{Email: &cleared}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := env.manager.VerifyEmail(ctx, &user.EmailVerificationRequest{Token: second}); err == nil {
+		t.Error("link sent before the email was cleared still verifies")
+	}
+
+	u, err := env.manager.Get(ctx, userID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if u.EmailVerified {
+		t.Error("cleared email is verified")
+	}
+}
+
+func TestVerifyEmailRejectsClearedEmail(t *testing.T) {
+	ctx, env := newTestEnv(t)
+	member := env.signUp(ctx, t, "alice", "alice@example.com", "Acme")
+
+	// A token issued some other way than through an email change.
+	plaintext, err := env.tokenManager.Issue(ctx, token.PurposeEmailVerification, member.ID.Hex(), "", time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = mgm.Coll(&User{}).UpdateByID(ctx, member.ID, bson.M{"$set": bson.M{"email": ""}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = env.manager.VerifyEmail(ctx, &user.EmailVerificationRequest{Token: plaintext}); err == nil {
+		t.Error("empty email was verified")
+	}
+}
+
+func TestRestoreTokenRestoresOnce(t *testing.T) {
+	ctx, env := newTestEnv(t)
+	member := env.signUp(ctx, t, "alice", "", "Acme")
+
+	deletion, err := env.manager.DeleteOrganization(ctx, &authentication.AuthenticatedActor{
+		ActorType:      actor.TypeUser,
+		ActorID:        member.ID.Hex(),
+		OrganizationID: member.OrganizationID,
+		HasFullAccess:  true,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := env.manager.RestoreOrganization(ctx, &organizationapi.RestoreRequest{Token: deletion.RestoreToken})
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	restored := 0
+
+	for err := range errs {
+		switch {
+		case err == nil:
+			restored++
+		case err != token.ErrInvalid:
+			t.Errorf("restore failed: %v", err)
+		}
+	}
+
+	if restored != 1 {
+		t.Fatalf("token restored the organization %d times, want once", restored)
+	}
+
+	if _, err = env.organizationManager.Get(ctx, member.OrganizationID); err != nil {
+		t.Errorf("organization is not restored: %v", err)
+	}
+}
+
+func TestChangePasswordEndsOtherSessionsAndResets(t *testing.T) {
+	ctx, env := newTestEnv(t)
+	member := env.signUp(ctx, t, "alice", "", "Acme")
+	userID := member.ID.Hex()
+
+	var sessions []*session.Session
+
+	for i := 0; i < 3; i++ {
+		s, err := env.sessionManager.Create(ctx, userID, member.OrganizationID, session.MethodPassword, testClient, false, time.Hour)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sessions = append(sessions, s)
+	}
+
+	reset, err := env.tokenManager.Issue(ctx, token.PurposePasswordReset, userID, member.OrganizationID, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := sessions[1].ID.Hex()
+
+	_, err = env.manager.ChangePassword(ctx, userID, member.OrganizationID, current, &user.PasswordChangeRequest{Password: "Another-Horse-7-Staple"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range sessions {
+		active, err := env.sessionManager.Active(ctx, s.ID.Hex(), userID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := s.ID.Hex() == current; active != want {
+			t.Errorf("session %s active = %v, want %v", s.ID.Hex(), active, want)
+		}
+	}
+
+	if _, err = env.tokenManager.Find(ctx, token.PurposePasswordReset, reset); err != token.ErrInvalid {
+		t.Errorf("password reset token returned %v after the change, want ErrInvalid", err)
+	}
+}
+
+func TestAddValidatesMetadata(t *testing.T) {
+	ctx, env := newTestEnv(t)
+	owner := env.signUp(ctx, t, "alice", "", "Acme")
+
+	_, err := env.organizationManager.UpdateAttributeSchema(ctx, owner.OrganizationID, &organizationapi.AttributeSchemaUpdateRequest{
+		Attributes: []organizationapi.AttributeDefinition{{Key: "department", Type: "string", Required: true}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &authentication.AuthenticatedActor{
+		ActorType:      actor.TypeUser,
+		ActorID:        owner.ID.Hex(),
+		OrganizationID: owner.OrganizationID,
+		HasFullAccess:  true,
+	}
+
+	var validationError *attribute.ValidationError
+
+	_, err = env.manager.Add(ctx, &user.AdditionRequest{Username: "bob", Email: "bob@example.com"}, admin)
+
+	if !errors.As(err, &validationError) {
+		t.Fatalf("Add without required metadata returned %v, want a validation error", err)
+	}
+
+	_, err = env.manager.Import(ctx, &user.ImportRequest{
+		AdditionRequest: user.AdditionRequest{Username: "carol", Email: "carol@example.com"},
+		PasswordHash:    "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+	}, admin)
+
+	if !errors.As(err, &validationError) {
+		t.Fatalf("Import without required metadata returned %v, want a validation error", err)
+	}
+
+	member, err := env.manager.Add(ctx, &user.AdditionRequest{
+		Username: "bob",
+		Email:    "bob@example.com",
+		Metadata: map[string]interface{}{"department": "sales"},
+	}, admin)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if member.Metadata["department"] != "sales" {
+		t.Errorf("metadata = %v, want the department", member.Metadata)
+	}
+}
@@ -1,17 +1,84 @@
 package user
 
 import (
+	"time"
+
 	"github.com/kamva/mgm/v3"
+	"github.com/superstackhq/identity/internal/app/identity/membership"
 	"github.com/superstackhq/identity/pkg/actor"
 )
 
+type Config struct {
+	WebURL          string
+	SessionDuration time.Duration
+	Retention       time.Duration
+}
+
+// User is an identity. It holds the credentials and profile shared by every
+// organization the user is a member of.
 type User struct {
+	mgm.DefaultModel      `bson:",inline"`
+	Username              string     `json:"username" bson:"username"`
+	Email                 string     `json:"email" bson:"email"`
+	EmailVerified         bool       `json:"email_verified" bson:"email_verified"`
+	DisplayName           string     `json:"display_name" bson:"display_name"`
+	GivenName             string     `json:"given_name" bson:"given_name"`
+	FamilyName            string     `json:"family_name" bson:"family_name"`
+	Locale                string     `json:"locale" bson:"locale"`
+	Timezone              string     `json:"timezone" bson:"timezone"`
+	AvatarURL             string     `json:"avatar_url" bson:"avatar_url"`
+	DefaultOrganizationID string     `json:"default_organization_id" bson:"default_organization_id"`
+	Password              string     `json:"-" bson:"password"`
+	PasswordChangedAt     time.Time  `json:"password_changed_at" bson:"password_changed_at"`
+	PasswordHistory       []string   `json:"-" bson:"password_history"`
+	PasswordBreached      bool       `json:"password_breached" bson:"password_breached"`
+	MustChangePassword    bool       `json:"must_change_password" bson:"must_change_password"`
+	Deleted               bool       `json:"deleted" bson:"deleted"`
+	DeletedAt             *time.Time `json:"deleted_at" bson:"deleted_at"`
+}
+
+// Member is a user as seen from within one organization.
+type Member struct {
+	*User
+	OrganizationID string                    `json:"organization_id"`
+	Admin          bool                      `json:"admin"`
+	Status         membership.Status         `json:"status"`
+	StatusHistory  []membership.StatusChange `json:"status_history"`
+	CreatorType    actor.Type                `json:"creator_type"`
+	CreatorID      string                    `json:"creator_id"`
+	Metadata       map[string]interface{}    `json:"metadata"`
+}
+
+// legacyUser is the shape of users stored before memberships were split out.
+type legacyUser struct {
+	mgm.DefaultModel `bson:",inline"`
+	Username         string            `bson:"username"`
+	Email            string            `bson:"email"`
+	OrganizationID   string            `bson:"organization_id"`
+	Admin            bool              `bson:"admin"`
+	Status           membership.Status `bson:"status"`
+	CreatorType      actor.Type        `bson:"creator_type"`
+	CreatorID        string            `bson:"creator_id"`
+	Deleted          bool              `bson:"deleted"`
+}
+
+type UsernameChangeReason string
+
+const (
+	UsernameChangeReasonRename    UsernameChangeReason = "RENAME"
+	UsernameChangeReasonMigration UsernameChangeReason = "MIGRATION"
+)
+
+// UsernameChange records a renamed user. Renames made while migrating
+// duplicate usernames name the user that kept the original one.
+type UsernameChange struct {
 	mgm.DefaultModel `bson:",inline"`
-	Username         string     `json:"username" bson:"username"`
-	Password         string     `json:"-" bson:"password"`
-	OrganizationID   string     `json:"organization_id" bson:"organization_id"`
-	Admin            bool       `json:"admin" bson:"admin"`
-	CreatorType      actor.Type `json:"creator_type" bson:"creator_type"`
-	CreatorID        string     `json:"creator_id" bson:"creator_id"`
-	Deleted          bool       `json:"deleted" bson:"deleted"`
+	UserID           string               `json:"user_id" bson:"user_id"`
+	OrganizationIDs  []string             `json:"organization_ids" bson:"organization_ids"`
+	OldUsername      string               `json:"old_username" bson:"old_username"`
+	NewUsername      string               `json:"new_username" bson:"new_username"`
+	Reason           UsernameChangeReason `json:"reason" bson:"reason"`
+	ConflictsWith    string               `json:"conflicts_with,omitempty" bson:"conflicts_with,omitempty"`
+	ActorType        actor.Type           `json:"actor_type,omitempty" bson:"actor_type,omitempty"`
+	ActorID          string               `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
 }
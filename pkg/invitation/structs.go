@@ -0,0 +1,6 @@
+package invitation
+
+type AcceptanceRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,67 @@
+package organization
+
+import "time"
+
+type PasswordPolicyUpdateRequest struct {
+	MinLength        int  `json:"min_length" binding:"min=0,max=128"`
+	RequireUppercase bool `json:"require_uppercase"`
+	RequireLowercase bool `json:"require_lowercase"`
+	RequireDigit     bool `json:"require_digit"`
+	RequireSymbol    bool `json:"require_symbol"`
+	MaxAgeDays       int  `json:"max_age_days" binding:"min=0"`
+	DisallowUsername bool `json:"disallow_username"`
+	HistoryDepth     int  `json:"history_depth" binding:"min=0,max=24"`
+}
+
+type AttributeDefinition struct {
+	Key         string   `json:"key" binding:"required"`
+	Type        string   `json:"type" binding:"required"`
+	Description string   `json:"description"`
+	Required    bool     `json:"required"`
+	Values      []string `json:"values"`
+	Pattern     string   `json:"pattern"`
+	Min         *float64 `json:"min"`
+	Max         *float64 `json:"max"`
+	Claim       bool     `json:"claim"`
+}
+
+type AttributeSchemaUpdateRequest struct {
+	Attributes []AttributeDefinition `json:"attributes" binding:"dive"`
+}
+
+type SettingsUpdateRequest struct {
+	DefaultLocale       string   `json:"default_locale"`
+	DefaultTimezone     string   `json:"default_timezone"`
+	AllowedEmailDomains []string `json:"allowed_email_domains" binding:"dive,fqdn"`
+}
+
+// UpdateRequest changes the fields that are present and leaves the others
+// alone.
+type UpdateRequest struct {
+	Name         *string                `json:"name" binding:"omitempty,min=1,max=128"`
+	DisplayName  *string                `json:"display_name" binding:"omitempty,max=256"`
+	LogoURL      *string                `json:"logo_url" binding:"omitempty,url"`
+	ContactEmail *string                `json:"contact_email" binding:"omitempty,email"`
+	Settings     *SettingsUpdateRequest `json:"settings"`
+}
+
+// Profile is the public view of an organization.
+type Profile struct {
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LogoURL     string `json:"logo_url"`
+}
+
+type DeletionResponse struct {
+	RestoreToken  string    `json:"restore_token"`
+	RestoreBefore time.Time `json:"restore_before"`
+}
+
+type RestoreRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type OwnershipTransferRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
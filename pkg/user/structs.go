@@ -1,19 +1,48 @@
 package user
 
+import "time"
+
 type SignUpRequest struct {
 	Username         string `json:"username" binding:"required"`
+	Email            string `json:"email" binding:"omitempty,email"`
 	Password         string `json:"password" binding:"required"`
 	OrganizationName string `json:"organization_name" binding:"required"`
 }
 
+// AuthenticationRequest identifies the organization by its slug or, for
+// older clients, by its name.
 type AuthenticationRequest struct {
-	Username         string `json:"username" binding:"required"`
+	Username         string `json:"username"`
+	Email            string `json:"email" binding:"omitempty,email"`
 	Password         string `json:"password" binding:"required"`
-	OrganizationName string `json:"organization_name" binding:"required"`
+	OrganizationSlug string `json:"organization_slug"`
+	OrganizationName string `json:"organization_name"`
+	OrganizationID   string `json:"organization_id"`
 }
 
 type AuthenticationResponse struct {
-	Token string `json:"token"`
+	Token                         string                `json:"token,omitempty"`
+	OrganizationID                string                `json:"organization_id,omitempty"`
+	PasswordExpired               bool                  `json:"password_expired"`
+	PasswordBreached              bool                  `json:"password_breached"`
+	PasswordChangeRequired        bool                  `json:"password_change_required"`
+	OrganizationSelectionRequired bool                  `json:"organization_selection_required"`
+	Organizations                 []*OrganizationChoice `json:"organizations,omitempty"`
+}
+
+type OrganizationChoice struct {
+	ID   string `json:"id"`
+	Slug string `json:"slug"`
+	Name string `json:"name"`
+}
+
+type OrganizationMembership struct {
+	ID      string `json:"id"`
+	Slug    string `json:"slug"`
+	Name    string `json:"name"`
+	Admin   bool   `json:"admin"`
+	Status  string `json:"status"`
+	Default bool   `json:"default"`
 }
 
 type PasswordChangeRequest struct {
@@ -21,8 +50,26 @@ type PasswordChangeRequest struct {
 }
 
 type AdditionRequest struct {
-	Username string `json:"username" binding:"required"`
+	Username string `json:"username"`
+	Email    string `json:"email" binding:"required,email"`
 	Admin    bool   `json:"admin"`
+
+	// Metadata sets custom attributes, which are validated like in
+	// MetadataUpdateRequest.
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// ImportRequest adds a user migrated from another system together with its
+// existing password hash and profile.
+type ImportRequest struct {
+	AdditionRequest
+	PasswordHash string `json:"password_hash"`
+	DisplayName  string `json:"display_name"`
+	GivenName    string `json:"given_name"`
+	FamilyName   string `json:"family_name"`
+	Locale       string `json:"locale"`
+	Timezone     string `json:"timezone"`
+	AvatarURL    string `json:"avatar_url"`
 }
 
 type PasswordResponse struct {
@@ -32,3 +79,61 @@ type PasswordResponse struct {
 type AdminChangeRequest struct {
 	Admin bool `json:"admin"`
 }
+
+type StatusChangeRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ForgotPasswordRequest struct {
+	Username         string `json:"username" binding:"required"`
+	OrganizationSlug string `json:"organization_slug" binding:"required_without=OrganizationName"`
+	OrganizationName string `json:"organization_name" binding:"required_without=OrganizationSlug"`
+}
+
+type PasswordResetConfirmationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ProfileUpdateRequest struct {
+	Email       *string `json:"email" binding:"omitempty,email"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=256"`
+	GivenName   *string `json:"given_name" binding:"omitempty,max=256"`
+	FamilyName  *string `json:"family_name" binding:"omitempty,max=256"`
+	Locale      *string `json:"locale" binding:"omitempty,max=35"`
+	Timezone    *string `json:"timezone" binding:"omitempty,max=64"`
+	AvatarURL   *string `json:"avatar_url" binding:"omitempty,url,max=2048"`
+
+	DefaultOrganizationID *string `json:"default_organization_id"`
+}
+
+type EmailVerificationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ListRequest struct {
+	Search         string    `form:"q"`
+	UsernamePrefix string    `form:"username"`
+	EmailPrefix    string    `form:"email"`
+	Admin          *bool     `form:"admin"`
+	CreatorID      string    `form:"creator_id"`
+	Status         []string  `form:"status"`
+	CreatedAfter   time.Time `form:"created_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	CreatedBefore  time.Time `form:"created_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedAfter   time.Time `form:"updated_after" time_format:"2006-01-02T15:04:05Z07:00"`
+	UpdatedBefore  time.Time `form:"updated_before" time_format:"2006-01-02T15:04:05Z07:00"`
+	Sort           string    `form:"sort"`
+
+	// Metadata is read from metadata[key]=value query parameters.
+	Metadata map[string]string `form:"-"`
+}
+
+// MetadataUpdateRequest sets custom attribute values. Attributes that are
+// left out keep their value and null removes one.
+type MetadataUpdateRequest struct {
+	Metadata map[string]interface{} `json:"metadata" binding:"required"`
+}
+
+type UsernameChangeRequest struct {
+	Username string `json:"username" binding:"required"`
+}